@@ -0,0 +1,221 @@
+package cli
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"log"
+	"os"
+	"search-service/search"
+	"time"
+)
+
+const backupBatchSize = 5000
+
+// Первая строка файла - заголовок с определением индекса, дальше по документу на строку
+type backupHeader struct {
+	Index      string                  `json:"index"`
+	CreatedAt  time.Time               `json:"created_at"`
+	Definition *search.IndexDefinition `json:"definition"`
+}
+
+func runExport(ctx context.Context, es *elasticsearch.Client, args []string) error {
+	var index, path string
+
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.StringVar(&index, "index", "", "index to export (nodes, hardware, addresses, streets)")
+	fs.StringVar(&path, "file", "", "output file (<index>-<timestamp>.ndjson.gz if empty)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if index == "" {
+		return fmt.Errorf("export: -index is required")
+	}
+
+	now := time.Now()
+
+	if path == "" {
+		path = fmt.Sprintf("%s-%s.ndjson.gz", index, now.Format("20060102150405"))
+	}
+
+	def, err := search.GetIndexDefinition(ctx, es, index)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zw := gzip.NewWriter(file)
+	enc := json.NewEncoder(zw)
+
+	if err = enc.Encode(backupHeader{Index: index, CreatedAt: now, Definition: def}); err != nil {
+		return err
+	}
+
+	exported := 0
+	err = search.ScanIndex(ctx, es, index, backupBatchSize, func(docs []search.RawDocument) error {
+		for _, doc := range docs {
+			if err := enc.Encode(doc); err != nil {
+				return err
+			}
+		}
+
+		exported += len(docs)
+		log.Printf("export: %d documents written\n", exported)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = zw.Close(); err != nil {
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	log.Printf("export: done, %d documents from %s written to %s\n", exported, index, path)
+
+	return nil
+}
+
+func runRestore(ctx context.Context, es *elasticsearch.Client, args []string) error {
+	var path, index string
+	var versioned, alias bool
+
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fs.StringVar(&path, "file", "", "file created by export")
+	fs.StringVar(&index, "index", "", "target index (the exported index name if empty)")
+	fs.BoolVar(&versioned, "versioned", false, "restore into <index>_<timestamp>")
+	fs.BoolVar(&alias, "alias", false, "point the exported index name as an alias to the restored index")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if path == "" {
+		return fmt.Errorf("restore: -file is required")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 64*1024), maxNDJSONLine)
+
+	if !scanner.Scan() {
+		if err = scanner.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("restore: empty file")
+	}
+
+	var header backupHeader
+	if err = json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return fmt.Errorf("restore: invalid header: %v", err)
+	}
+
+	if index == "" {
+		index = header.Index
+	}
+
+	if versioned {
+		index = fmt.Sprintf("%s_%s", index, time.Now().Format("20060102150405"))
+	}
+
+	// Существующий индекс не перезаписываем - для этого есть -versioned
+	exists, err := search.IndexExists(ctx, es, index)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("restore: index %s already exists", index)
+	}
+
+	// Alias не может называться так же, как существующий индекс - проверяем до загрузки, а не после
+	if alias && index != header.Index {
+		concrete, err := search.IsConcreteIndex(ctx, es, header.Index)
+		if err != nil {
+			return err
+		}
+		if concrete {
+			return fmt.Errorf("restore: %s is an index, not an alias; delete or reindex it before restoring with -alias", header.Index)
+		}
+	}
+
+	if err = search.CreateIndex(ctx, es, index, header.Definition); err != nil {
+		return err
+	}
+
+	indexer, err := search.NewRawIndexer(es, index)
+	if err != nil {
+		return err
+	}
+
+	read := 0
+	for scanner.Scan() {
+		var doc search.RawDocument
+		if err = json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			break
+		}
+
+		if err = indexer.Add(ctx, doc); err != nil {
+			break
+		}
+
+		read++
+		if read%importProgressEvery == 0 {
+			log.Printf("restore: %d documents read\n", read)
+		}
+	}
+
+	if err == nil {
+		err = scanner.Err()
+	}
+
+	summary, closeErr := indexer.Close(ctx)
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	log.Printf("restore: done, %d documents read, %d indexed, %d failed into %s\n", read, summary.Indexed, summary.Failed, index)
+
+	if len(summary.FailedIDs) > 0 {
+		log.Printf("restore: failed ids: %v\n", summary.FailedIDs)
+	}
+
+	if alias && index != header.Index {
+		if err = search.PointAlias(ctx, es, header.Index, index); err != nil {
+			return err
+		}
+
+		log.Printf("restore: alias %s now points to %s\n", header.Index, index)
+	}
+
+	return nil
+}
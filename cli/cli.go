@@ -0,0 +1,23 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// Run выполняет подкоманду вместо запуска сервера
+func Run(ctx context.Context, es *elasticsearch.Client, command string, args []string) error {
+	switch command {
+	case "import":
+		return runImport(ctx, es, args)
+	case "export":
+		return runExport(ctx, es, args)
+	case "restore":
+		return runRestore(ctx, es, args)
+	case "reconcile":
+		return runReconcile(ctx, es, args)
+	default:
+		return fmt.Errorf("unknown command: %s", command)
+	}
+}
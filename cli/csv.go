@@ -0,0 +1,233 @@
+package cli
+
+import (
+	"fmt"
+	"search-service/proto/searchpb"
+	"strconv"
+	"strings"
+)
+
+// csvRecord даёт доступ к значениям строки по имени колонки из заголовка.
+// Отсутствующая колонка и пустое значение считаются нулевым значением поля
+type csvRecord struct {
+	columns map[string]int
+	values  []string
+}
+
+func newCSVColumns(header []string) map[string]int {
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	return columns
+}
+
+func (r csvRecord) string(column string) string {
+	i, ok := r.columns[column]
+	if !ok || i >= len(r.values) {
+		return ""
+	}
+
+	return strings.TrimSpace(r.values[i])
+}
+
+func (r csvRecord) hasPrefix(prefix string) bool {
+	for column := range r.columns {
+		if strings.HasPrefix(column, prefix) && r.string(column) != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r csvRecord) int32(column string) (int32, error) {
+	value := r.string(column)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("column %s: invalid integer %q", column, value)
+	}
+
+	return int32(n), nil
+}
+
+func (r csvRecord) updatedAt(column string) (int64, error) {
+	updatedAt, err := parseUpdatedAt(r.string(column))
+	if err != nil {
+		return 0, fmt.Errorf("column %s: %v", column, err)
+	}
+
+	return updatedAt, nil
+}
+
+func (r csvRecord) float64(column string) (float64, error) {
+	value := r.string(column)
+	if value == "" {
+		return 0, nil
+	}
+
+	f, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+	if err != nil {
+		return 0, fmt.Errorf("column %s: invalid number %q", column, value)
+	}
+
+	return f, nil
+}
+
+func (r csvRecord) bool(column string) (bool, error) {
+	value := r.string(column)
+	if value == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("column %s: invalid boolean %q", column, value)
+	}
+
+	return b, nil
+}
+
+// Координаты задаются парой колонок <prefix>lat и <prefix>lon; если обе пустые - точки нет
+func (r csvRecord) geoPoint(prefix string) (*searchpb.GeoPoint, error) {
+	if r.string(prefix+"lat") == "" && r.string(prefix+"lon") == "" {
+		return nil, nil
+	}
+
+	lat, err := r.float64(prefix + "lat")
+	if err != nil {
+		return nil, err
+	}
+
+	lon, err := r.float64(prefix + "lon")
+	if err != nil {
+		return nil, err
+	}
+
+	return &searchpb.GeoPoint{Lat: lat, Lon: lon}, nil
+}
+
+func addressFromRecord(r csvRecord) (*searchpb.Address, error) {
+	var err error
+	address := &searchpb.Address{
+		StreetName:          r.string("street_name"),
+		StreetTypeShortName: r.string("street_type_short_name"),
+		HouseName:           r.string("house_name"),
+		HouseTypeShortName:  r.string("house_type_short_name"),
+		Region:              r.string("region"),
+		District:            r.string("district"),
+		Locality:            r.string("locality"),
+	}
+
+	if address.HouseId, err = r.int32("house_id"); err != nil {
+		return nil, err
+	}
+	if address.StreetId, err = r.int32("street_id"); err != nil {
+		return nil, err
+	}
+	if address.Popularity, err = r.int32("popularity"); err != nil {
+		return nil, err
+	}
+	if address.UpdatedAt, err = r.updatedAt("updated_at"); err != nil {
+		return nil, err
+	}
+	if address.Location, err = r.geoPoint(""); err != nil {
+		return nil, err
+	}
+
+	return address, nil
+}
+
+// Адрес узла и оборудования задаётся колонками с префиксом address.
+func nodeAddressFromRecord(r csvRecord) (*searchpb.NodeAddress, error) {
+	if !r.hasPrefix("address.") {
+		return nil, nil
+	}
+
+	var err error
+	address := &searchpb.NodeAddress{
+		StreetName: r.string("address.street_name"),
+		StreetType: r.string("address.street_type"),
+		HouseName:  r.string("address.house_name"),
+		HouseType:  r.string("address.house_type"),
+		Region:     r.string("address.region"),
+		District:   r.string("address.district"),
+		Locality:   r.string("address.locality"),
+	}
+
+	if address.HouseId, err = r.int32("address.house_id"); err != nil {
+		return nil, err
+	}
+	if address.Location, err = r.geoPoint("address."); err != nil {
+		return nil, err
+	}
+
+	return address, nil
+}
+
+func nodeFromRecord(r csvRecord) (*searchpb.Node, error) {
+	var err error
+	node := &searchpb.Node{
+		Name:  r.string("name"),
+		Zone:  r.string("zone"),
+		Owner: r.string("owner"),
+		Type:  r.string("type"),
+	}
+
+	if node.Id, err = r.int32("id"); err != nil {
+		return nil, err
+	}
+	if node.IsDelete, err = r.bool("is_delete"); err != nil {
+		return nil, err
+	}
+	if node.IsPassive, err = r.bool("is_passive"); err != nil {
+		return nil, err
+	}
+	if node.Popularity, err = r.int32("popularity"); err != nil {
+		return nil, err
+	}
+	if node.UpdatedAt, err = r.updatedAt("updated_at"); err != nil {
+		return nil, err
+	}
+	if node.Address, err = nodeAddressFromRecord(r); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+func hardwareFromRecord(r csvRecord) (*searchpb.Hardware, error) {
+	var err error
+	hardware := &searchpb.Hardware{
+		Type:      r.string("type"),
+		NodeName:  r.string("node_name"),
+		ModelName: r.string("model_name"),
+		IpAddress: r.string("ip_address"),
+	}
+
+	if hardware.Id, err = r.int32("id"); err != nil {
+		return nil, err
+	}
+	if hardware.NodeId, err = r.int32("node_id"); err != nil {
+		return nil, err
+	}
+	if hardware.IsDelete, err = r.bool("is_delete"); err != nil {
+		return nil, err
+	}
+	if hardware.Popularity, err = r.int32("popularity"); err != nil {
+		return nil, err
+	}
+	if hardware.UpdatedAt, err = r.updatedAt("updated_at"); err != nil {
+		return nil, err
+	}
+	if hardware.Address, err = nodeAddressFromRecord(r); err != nil {
+		return nil, err
+	}
+
+	return hardware, nil
+}
@@ -0,0 +1,369 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"search-service/proto/searchpb"
+	"search-service/search"
+	"strings"
+)
+
+const (
+	importProgressEvery = 10000
+	maxNDJSONLine       = 4 << 20
+	rejectedLinePreview = 1024
+)
+
+type importOptions struct {
+	entity  string
+	file    string
+	format  string
+	rejects string
+}
+
+// importer описывает, как читать, проверять и индексировать одну сущность
+type importer[T any] struct {
+	ensure     func(ctx context.Context) error
+	newIndexer func() (*search.StreamIndexer[T], error)
+	fromRecord func(r csvRecord) (T, error)
+	validate   func(item T) error
+}
+
+type rejectedRow struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+	Row   string `json:"row"`
+}
+
+func runImport(ctx context.Context, es *elasticsearch.Client, args []string) error {
+	var opts importOptions
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.StringVar(&opts.entity, "entity", "", "address, node or hardware")
+	fs.StringVar(&opts.file, "file", "", "path to the NDJSON or CSV file")
+	fs.StringVar(&opts.format, "format", "", "ndjson or csv (by file extension if empty)")
+	fs.StringVar(&opts.rejects, "rejects", "", "file for invalid rows (<file>.rejects.ndjson if empty)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if opts.file == "" {
+		return fmt.Errorf("import: -file is required")
+	}
+
+	if opts.format == "" {
+		opts.format = strings.TrimPrefix(strings.ToLower(filepath.Ext(opts.file)), ".")
+	}
+
+	if opts.format == "jsonl" || opts.format == "json" {
+		opts.format = "ndjson"
+	}
+
+	if opts.format != "ndjson" && opts.format != "csv" {
+		return fmt.Errorf("import: unknown format %q", opts.format)
+	}
+
+	if opts.rejects == "" {
+		opts.rejects = opts.file + ".rejects.ndjson"
+	}
+
+	switch opts.entity {
+	case "address":
+		s := &search.DefaultAddressSearch{Elastic: es}
+		return importFile(ctx, opts, importer[*searchpb.Address]{
+			ensure:     s.EnsureIndexAddress,
+			newIndexer: s.NewAddressIndexer,
+			fromRecord: addressFromRecord,
+			validate:   validateAddress,
+		})
+	case "node":
+		s := &search.DefaultNodeSearch{Elastic: es, SkipRenamePropagation: search.RenamePropagationDisabled()}
+		return importFile(ctx, opts, importer[*searchpb.Node]{
+			ensure:     s.EnsureIndexNode,
+			newIndexer: s.NewNodeIndexer,
+			fromRecord: nodeFromRecord,
+			validate:   validateNode,
+		})
+	case "hardware":
+		s := &search.DefaultHardwareSearch{Elastic: es}
+		return importFile(ctx, opts, importer[*searchpb.Hardware]{
+			ensure:     s.EnsureIndexHardware,
+			newIndexer: s.NewHardwareIndexer,
+			fromRecord: hardwareFromRecord,
+			validate:   validateHardware,
+		})
+	default:
+		return fmt.Errorf("import: unknown entity %q", opts.entity)
+	}
+}
+
+func importFile[T any](ctx context.Context, opts importOptions, imp importer[T]) error {
+	file, err := os.Open(opts.file)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err = imp.ensure(ctx); err != nil {
+		return fmt.Errorf("import: failed to ensure index: %v", err)
+	}
+
+	indexer, err := imp.newIndexer()
+	if err != nil {
+		return err
+	}
+
+	rejects := &rejectsWriter{path: opts.rejects}
+	defer rejects.Close()
+
+	var read, rejected int
+
+	handle := func(line int, raw string, item T, err error) error {
+		read++
+
+		if err == nil {
+			err = imp.validate(item)
+		}
+
+		if err != nil {
+			rejected++
+			if err = rejects.Write(rejectedRow{Line: line, Error: err.Error(), Row: raw}); err != nil {
+				return err
+			}
+		} else if err = indexer.Add(ctx, item); err != nil {
+			return err
+		}
+
+		if read%importProgressEvery == 0 {
+			log.Printf("import: %d rows read, %d rejected\n", read, rejected)
+		}
+
+		return nil
+	}
+
+	if opts.format == "csv" {
+		err = readCSV(file, imp.fromRecord, handle)
+	} else {
+		err = readNDJSON(file, handle)
+	}
+
+	summary, closeErr := indexer.Close(ctx)
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	log.Printf("import: done, %d rows read, %d indexed, %d outdated, %d failed, %d rejected\n", read, summary.Indexed, summary.Skipped, summary.Failed, rejected)
+
+	if len(summary.FailedIDs) > 0 {
+		log.Printf("import: failed ids: %v\n", summary.FailedIDs)
+	}
+
+	if rejected > 0 {
+		log.Printf("import: rejected rows written to %s\n", opts.rejects)
+	}
+
+	return nil
+}
+
+func readNDJSON[T any](r io.Reader, handle func(line int, raw string, item T, err error) error) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+
+	line := 0
+	for {
+		data, tooLong, readErr := readNDJSONLine(reader)
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+
+		line++
+
+		raw := bytes.TrimSpace(data)
+
+		// Слишком длинную строку целиком не держим: отклоняем её с началом строки, импорт продолжается
+		if tooLong {
+			err := fmt.Errorf("line is longer than %d bytes", maxNDJSONLine)
+			if err = handle(line, string(raw[:min(len(raw), rejectedLinePreview)]), *new(T), err); err != nil {
+				return err
+			}
+		} else if len(raw) > 0 {
+			// Неизвестные поля - скорее всего опечатка в выгрузке, такую строку лучше отклонить
+			var item T
+			dec := json.NewDecoder(bytes.NewReader(raw))
+			dec.DisallowUnknownFields()
+			err := dec.Decode(&item)
+
+			if err = handle(line, string(raw), item, err); err != nil {
+				return err
+			}
+		}
+
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
+
+// readNDJSONLine читает строку до \n; у строки длиннее maxNDJSONLine остаётся только начало
+func readNDJSONLine(r *bufio.Reader) ([]byte, bool, error) {
+	var line []byte
+	tooLong := false
+
+	for {
+		chunk, err := r.ReadSlice('\n')
+
+		if len(line)+len(chunk) > maxNDJSONLine {
+			tooLong = true
+		}
+
+		if len(line) < rejectedLinePreview || !tooLong {
+			line = append(line, chunk...)
+		}
+
+		if err != bufio.ErrBufferFull {
+			return line, tooLong, err
+		}
+	}
+}
+
+func readCSV[T any](r io.Reader, fromRecord func(csvRecord) (T, error), handle func(line int, raw string, item T, err error) error) error {
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("import: failed to read csv header: %v", err)
+	}
+
+	columns := newCSVColumns(header)
+
+	for {
+		values, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		var line int
+		var parseErr *csv.ParseError
+
+		if err == nil {
+			line, _ = reader.FieldPos(0)
+		} else if errors.As(err, &parseErr) {
+			line = parseErr.Line
+		} else {
+			return err
+		}
+
+		var item T
+		if err == nil {
+			item, err = fromRecord(csvRecord{columns: columns, values: values})
+		}
+
+		if err = handle(line, csvLine(values), item, err); err != nil {
+			return err
+		}
+	}
+}
+
+func csvLine(values []string) string {
+	var buf bytes.Buffer
+
+	w := csv.NewWriter(&buf)
+	w.Write(values)
+	w.Flush()
+
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+// rejectsWriter создаёт файл только при первой отклонённой строке
+type rejectsWriter struct {
+	path string
+	file *os.File
+	enc  *json.Encoder
+}
+
+func (w *rejectsWriter) Write(row rejectedRow) error {
+	if w.file == nil {
+		file, err := os.Create(w.path)
+		if err != nil {
+			return err
+		}
+
+		w.file = file
+		w.enc = json.NewEncoder(file)
+	}
+
+	return w.enc.Encode(row)
+}
+
+func (w *rejectsWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+
+	return w.file.Close()
+}
+
+func validateGeoPoint(point *searchpb.GeoPoint) error {
+	if point == nil {
+		return nil
+	}
+
+	if point.GetLat() < -90 || point.GetLat() > 90 || point.GetLon() < -180 || point.GetLon() > 180 {
+		return fmt.Errorf("location out of range: %v,%v", point.GetLat(), point.GetLon())
+	}
+
+	return nil
+}
+
+func validateAddress(address *searchpb.Address) error {
+	if address == nil {
+		return fmt.Errorf("empty row")
+	}
+	if address.HouseId <= 0 {
+		return fmt.Errorf("house_id is required")
+	}
+	if address.StreetName == "" {
+		return fmt.Errorf("street_name is required")
+	}
+
+	return validateGeoPoint(address.Location)
+}
+
+func validateNode(node *searchpb.Node) error {
+	if node == nil {
+		return fmt.Errorf("empty row")
+	}
+	if node.Id <= 0 {
+		return fmt.Errorf("id is required")
+	}
+	if node.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	return validateGeoPoint(node.Address.GetLocation())
+}
+
+func validateHardware(hardware *searchpb.Hardware) error {
+	if hardware == nil {
+		return fmt.Errorf("empty row")
+	}
+	if hardware.Id <= 0 {
+		return fmt.Errorf("id is required")
+	}
+
+	return validateGeoPoint(hardware.Address.GetLocation())
+}
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"io"
+	"log"
+	"os"
+	"search-service/kafka"
+	"search-service/proto/searchpb"
+	"search-service/search"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func runReconcile(ctx context.Context, es *elasticsearch.Client, args []string) error {
+	var entityName, path, reportPath string
+	var fix, force bool
+
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	fs.StringVar(&entityName, "entity", "", "address, node or hardware")
+	fs.StringVar(&path, "file", "", "CSV with id and optional updated_at (unix ms or RFC3339)")
+	fs.StringVar(&reportPath, "report", "", "write the full report as JSON to this file")
+	fs.BoolVar(&fix, "fix", false, "delete extra documents and request a re-send of missing and stale ones")
+	fs.BoolVar(&force, "force", false, "allow -fix to delete more than 1000 documents or 10% of the index")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	entity, err := parseEntity(entityName)
+	if err != nil {
+		return err
+	}
+
+	if path == "" {
+		return fmt.Errorf("reconcile: -file is required")
+	}
+
+	source, err := readSourceIDs(path)
+	if err != nil {
+		return err
+	}
+
+	reconciler := &search.DefaultReconciler{Elastic: es}
+
+	if fix {
+		resendRequester := kafka.NewResendRequester()
+		defer resendRequester.Close()
+
+		reconciler.Resender = resendRequester
+	}
+
+	report, err := reconciler.Reconcile(ctx, entity, source, fix, force)
+	if errors.Is(err, search.ErrUnsafeReconcile) && report != nil {
+		// Отчёт без исправлений всё равно полезен, чтобы понять, что пошло не так
+		log.Printf("reconcile: %d in source, %d missing, %d extra, %d stale\n", len(source), len(report.Missing), len(report.Extra), len(report.Stale))
+	}
+	if err != nil {
+		return fmt.Errorf("reconcile: %v", err)
+	}
+
+	log.Printf("reconcile: %d in source, %d missing, %d extra, %d stale\n", len(source), len(report.Missing), len(report.Extra), len(report.Stale))
+
+	if fix {
+		log.Printf("reconcile: %d deleted, %d re-send requested\n", report.Deleted, report.ResendRequested)
+	}
+
+	if reportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		if err = os.WriteFile(reportPath, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseEntity(name string) (searchpb.Entity, error) {
+	switch name {
+	case "node":
+		return searchpb.Entity_ENTITY_NODE, nil
+	case "hardware":
+		return searchpb.Entity_ENTITY_HARDWARE, nil
+	case "address":
+		return searchpb.Entity_ENTITY_ADDRESS, nil
+	default:
+		return searchpb.Entity_ENTITY_UNSPECIFIED, fmt.Errorf("unknown entity %q", name)
+	}
+}
+
+// Первая строка пропускается, если это заголовок (id не число)
+func readSourceIDs(path string) (map[int32]int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	source := make(map[int32]int64)
+
+	for line := 1; ; line++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			return source, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		id, err := strconv.ParseInt(strings.TrimSpace(values[0]), 10, 32)
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: invalid id %q", line, values[0])
+		}
+
+		var updatedAt int64
+		if len(values) > 1 {
+			if updatedAt, err = parseUpdatedAt(values[1]); err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+		}
+
+		source[int32(id)] = updatedAt
+	}
+}
+
+func parseUpdatedAt(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ms, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid updated_at %q", value)
+	}
+
+	return t.UnixMilli(), nil
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"log"
 	"search-service/proto/searchpb"
+	"search-service/search"
+	"strings"
+	"time"
 )
 
 func (s *SearchServiceServer) IndexAddress(ctx context.Context, req *searchpb.Address) (*searchpb.Empty, error) {
@@ -20,7 +24,7 @@ func (s *SearchServiceServer) IndexAddresses(ctx context.Context, req *searchpb.
 		return nil, status.Error(codes.Internal, "failed to ensure index")
 	}
 
-	if err := s.AddressSearch.IndexAddresses(ctx, req.Addresses); err != nil {
+	if _, err := s.AddressSearch.IndexAddresses(ctx, req.Addresses); err != nil {
 		return nil, status.Error(codes.Internal, "failed to index addresses")
 	}
 
@@ -28,10 +32,181 @@ func (s *SearchServiceServer) IndexAddresses(ctx context.Context, req *searchpb.
 }
 
 func (s *SearchServiceServer) SearchAddresses(ctx context.Context, req *searchpb.SearchAddress) (*searchpb.SearchAddressesResponse, error) {
-	ids, total, err := s.AddressSearch.SearchAddresses(ctx, req)
+	started := time.Now()
+
+	result, err := s.AddressSearch.SearchAddresses(ctx, req)
 	if err != nil {
 		return nil, status.Error(codes.Internal, "failed to search addresses")
 	}
 
-	return &searchpb.SearchAddressesResponse{HousesIDs: ids, Total: total}, nil
+	s.recordSearch(ctx, "address", addressQuery(req), addressFilters(req), result.Total, started)
+
+	resp := &searchpb.SearchAddressesResponse{
+		Total:          result.Total,
+		Distances:      result.Distances,
+		Suggestions:    result.Suggestions,
+		CorrectedQuery: result.CorrectedQuery,
+		Parsed:         result.ParsedAddress,
+	}
+
+	for _, group := range result.AdminGroups {
+		resp.AdminGroups = append(resp.AdminGroups, &searchpb.AdminGroup{
+			Region:   group.Region,
+			District: group.District,
+			Locality: group.Locality,
+			Count:    group.Count,
+		})
+	}
+
+	if result.StreetLevel {
+		resp.StreetsIDs = result.IDs
+
+		if req.GetIncludeSource() {
+			if resp.Streets, err = search.DecodeSources[searchpb.Street](result.Sources); err != nil {
+				return nil, status.Error(codes.Internal, "failed to decode streets")
+			}
+		}
+
+		return resp, nil
+	}
+
+	resp.HousesIDs = result.IDs
+
+	if req.GetIncludeSource() {
+		if resp.Addresses, err = search.DecodeSources[searchpb.Address](result.Sources); err != nil {
+			return nil, status.Error(codes.Internal, "failed to decode addresses")
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *SearchServiceServer) ListStreetHouses(ctx context.Context, req *searchpb.StreetHousesRequest) (*searchpb.SearchAddressesResponse, error) {
+	if req.GetStreetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "street_id is required")
+	}
+
+	result, err := s.AddressSearch.SearchStreetHouses(ctx, req)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list street houses")
+	}
+
+	resp := &searchpb.SearchAddressesResponse{
+		HousesIDs: result.IDs,
+		Total:     result.Total,
+	}
+
+	if req.GetIncludeSource() {
+		if resp.Addresses, err = search.DecodeSources[searchpb.Address](result.Sources); err != nil {
+			return nil, status.Error(codes.Internal, "failed to decode addresses")
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *SearchServiceServer) IndexAddressesStream(stream searchpb.SearchService_IndexAddressesStreamServer) error {
+	ctx := stream.Context()
+
+	if err := s.AddressSearch.EnsureIndexAddress(ctx); err != nil {
+		return status.Error(codes.Internal, "failed to ensure index")
+	}
+
+	indexer, err := s.AddressSearch.NewAddressIndexer()
+	if err != nil {
+		return status.Error(codes.Internal, "failed to start indexer")
+	}
+
+	summary, err := receiveAndIndex(ctx, indexer, func() ([]*searchpb.Address, error) {
+		req, err := stream.Recv()
+		return req.GetAddresses(), err
+	})
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(summary)
+}
+
+func (s *SearchServiceServer) UpdateAddresses(ctx context.Context, req *searchpb.UpdateAddressesRequest) (*searchpb.UpdateAddressesResponse, error) {
+	if err := s.AddressSearch.EnsureIndexAddress(ctx); err != nil {
+		return nil, status.Error(codes.Internal, "failed to ensure index")
+	}
+
+	indexed, err := s.AddressSearch.IndexAddresses(ctx, req.GetAddresses())
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to index addresses")
+	}
+
+	resp := &searchpb.UpdateAddressesResponse{}
+
+	// Адреса, пропущенные как устаревшие, не распространяем
+	if !req.GetCascade() || len(indexed) == 0 {
+		return resp, nil
+	}
+
+	tasks, err := s.AddressSearch.CascadeAddresses(ctx, indexed)
+	if err != nil {
+		log.Println(err)
+		return nil, status.Error(codes.Internal, "failed to start cascade update")
+	}
+
+	// Задачи переживают запрос, поэтому следим за ними без его отмены
+	s.AddressSearch.WatchCascade(context.WithoutCancel(ctx), tasks)
+
+	for _, task := range tasks {
+		resp.Tasks = append(resp.Tasks, &searchpb.CascadeTask{
+			Index:  task.Index,
+			TaskId: task.TaskID,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *SearchServiceServer) GetCascadeTask(ctx context.Context, req *searchpb.CascadeTaskRequest) (*searchpb.CascadeTaskStatus, error) {
+	if req.GetTaskId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "task_id is required")
+	}
+
+	task, err := s.AddressSearch.GetCascadeTask(ctx, req.GetTaskId())
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to get cascade task")
+	}
+
+	return &searchpb.CascadeTaskStatus{
+		TaskId:           task.TaskID,
+		Completed:        task.Completed,
+		Total:            task.Total,
+		Updated:          task.Updated,
+		Noops:            task.Noops,
+		VersionConflicts: task.VersionConflicts,
+		Failures:         task.Failures,
+		Error:            task.Error,
+	}, nil
+}
+
+// Свободный запрос или пара улица/дом - в аналитике это один текст
+func addressQuery(req *searchpb.SearchAddress) string {
+	if req.GetQuery() != "" {
+		return req.GetQuery()
+	}
+
+	return strings.TrimSpace(req.GetStreetQuery() + " " + req.GetHouseQuery())
+}
+
+func addressFilters(req *searchpb.SearchAddress) map[string]interface{} {
+	filters := map[string]interface{}{}
+
+	if req.GetStreetType() != "" {
+		filters["street_type"] = req.GetStreetType()
+	}
+	if req.GetGeo() != nil {
+		filters["geo"] = req.GetGeo()
+	}
+	if req.GetAdmin() != nil {
+		filters["admin"] = req.GetAdmin()
+	}
+
+	return filters
 }
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/status"
+	"log"
+	"search-service/proto/searchpb"
+	"search-service/search"
+	"time"
+)
+
+func (s *SearchServiceServer) SearchAll(ctx context.Context, req *searchpb.SearchAllRequest) (*searchpb.SearchAllResponse, error) {
+	started := time.Now()
+
+	result, err := s.GlobalSearch.SearchAll(ctx, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+
+		return nil, searchError(err, "failed to search")
+	}
+
+	resp := &searchpb.SearchAllResponse{TimedOut: result.TimedOut()}
+
+	var total int32
+
+	for _, group := range result.Groups {
+		pbGroup := &searchpb.SearchAllGroup{Limit: group.Limit}
+
+		var syntaxErr *search.QuerySyntaxError
+
+		switch {
+		case errors.As(group.Err, &syntaxErr):
+			pbGroup.Error = syntaxErr.Error()
+		case group.Err != nil:
+			log.Println(group.Err)
+			pbGroup.Error = "search failed"
+		default:
+			pbGroup.TimedOut = group.TimedOut
+			pbGroup.IDs = group.Result.IDs
+			pbGroup.Total = group.Result.Total
+			total += group.Result.Total
+		}
+
+		switch group.Entity {
+		case searchpb.Entity_ENTITY_NODE:
+			resp.Nodes = pbGroup
+		case searchpb.Entity_ENTITY_HARDWARE:
+			resp.Hardware = pbGroup
+		case searchpb.Entity_ENTITY_ADDRESS:
+			resp.Addresses = pbGroup
+		}
+	}
+
+	for _, hit := range result.Blended {
+		resp.Blended = append(resp.Blended, &searchpb.BlendedHit{
+			Entity: hit.Entity,
+			Id:     hit.ID,
+			Score:  hit.Score,
+		})
+	}
+
+	s.recordSearch(ctx, "all", req.GetQuery(), map[string]interface{}{
+		"node":     req.GetNodeFilter(),
+		"hardware": req.GetHardwareFilter(),
+	}, total, started)
+
+	return resp, nil
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	"search-service/proto/searchpb"
+	"search-service/search"
+	"time"
+)
+
+const (
+	defaultStatsWindow = 24 * time.Hour
+	defaultStatsSize   = 10
+	maxStatsSize       = 100
+)
+
+func (s *SearchServiceServer) SearchStats(ctx context.Context, req *searchpb.SearchStatsRequest) (*searchpb.SearchStatsResponse, error) {
+	to := time.Now()
+	if req.GetTo() > 0 {
+		to = time.UnixMilli(req.GetTo())
+	}
+
+	from := to.Add(-defaultStatsWindow)
+	if req.GetFrom() > 0 {
+		from = time.UnixMilli(req.GetFrom())
+	}
+
+	if !from.Before(to) {
+		return nil, status.Error(codes.InvalidArgument, "from must be before to")
+	}
+
+	size := int(req.GetSize())
+	if size <= 0 {
+		size = defaultStatsSize
+	}
+	if size > maxStatsSize {
+		size = maxStatsSize
+	}
+
+	stats, err := s.Analytics.SearchStats(ctx, analyticsEntity(req.GetEntity()), from, to, size)
+	if errors.Is(err, search.ErrAnalyticsDisabled) {
+		return nil, status.Error(codes.Unavailable, "search analytics is disabled")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to get search stats")
+	}
+
+	resp := &searchpb.SearchStatsResponse{
+		Searches:           stats.Searches,
+		ZeroResultSearches: stats.ZeroResultSearches,
+	}
+
+	for _, query := range stats.TopQueries {
+		resp.TopQueries = append(resp.TopQueries, &searchpb.QueryCount{Query: query.Query, Count: query.Count})
+	}
+
+	for _, query := range stats.TopZeroResultQueries {
+		resp.TopZeroResultQueries = append(resp.TopZeroResultQueries, &searchpb.QueryCount{Query: query.Query, Count: query.Count})
+	}
+
+	for _, latency := range stats.Latency {
+		resp.Latency = append(resp.Latency, &searchpb.LatencyPercentile{Percent: latency.Percent, Millis: latency.Millis})
+	}
+
+	return resp, nil
+}
+
+// recordSearch отправляет событие в аналитику; запись идёт в фоне и на ответ не влияет
+func (s *SearchServiceServer) recordSearch(ctx context.Context, entity string, query string, filters interface{}, total int32, started time.Time) {
+	if s.Analytics == nil {
+		return
+	}
+
+	s.Analytics.Record(&search.SearchEvent{
+		Timestamp:  started.UnixMilli(),
+		Entity:     entity,
+		Query:      search.NormalizeQuery(query),
+		Filters:    filters,
+		Total:      total,
+		ZeroResult: total == 0,
+		LatencyMs:  time.Since(started).Milliseconds(),
+		Caller:     callerOf(ctx),
+	})
+}
+
+// Поиск по всем сущностям (SearchAll) записывается как "all", UNSPECIFIED в статистике - все события
+func analyticsEntity(entity searchpb.Entity) string {
+	switch entity {
+	case searchpb.Entity_ENTITY_NODE:
+		return "node"
+	case searchpb.Entity_ENTITY_HARDWARE:
+		return "hardware"
+	case searchpb.Entity_ENTITY_ADDRESS:
+		return "address"
+	default:
+		return ""
+	}
+}
+
+// Вызывающий сервис представляется заголовком x-caller, иначе берём адрес соединения
+func callerOf(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if callers := md.Get("x-caller"); len(callers) > 0 && callers[0] != "" {
+			return callers[0]
+		}
+	}
+
+	// Порт у каждого соединения свой, по нему клиентов не различить
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+
+		return p.Addr.String()
+	}
+
+	return ""
+}
@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"log"
 	"search-service/proto/searchpb"
+	"search-service/search"
+	"time"
 )
 
 func (s *SearchServiceServer) IndexHardwareSingle(ctx context.Context, req *searchpb.Hardware) (*searchpb.Empty, error) {
@@ -29,11 +32,107 @@ func (s *SearchServiceServer) IndexHardware(ctx context.Context, req *searchpb.I
 }
 
 func (s *SearchServiceServer) SearchHardware(ctx context.Context, req *searchpb.SearchHardwareRequest) (*searchpb.SearchHardwareResponse, error) {
-	ids, total, err := s.HardwareSearch.SearchHardware(ctx, req.Search, req.SearchFilter)
+	started := time.Now()
+
+	result, err := s.HardwareSearch.SearchHardware(ctx, req.Search, req.SearchFilter)
 	if err != nil {
 		log.Println(err)
-		return nil, status.Error(codes.Internal, "failed to search hardware")
+		return nil, searchError(err, "failed to search hardware")
+	}
+
+	s.recordSearch(ctx, "hardware", req.Search.GetQuery(), req.SearchFilter, result.Total, started)
+
+	var hardware []*searchpb.Hardware
+	if req.Search.GetIncludeSource() {
+		if hardware, err = search.DecodeSources[searchpb.Hardware](result.Sources); err != nil {
+			return nil, status.Error(codes.Internal, "failed to decode hardware")
+		}
+	}
+
+	return &searchpb.SearchHardwareResponse{
+		HardwareIDs:    result.IDs,
+		Total:          result.Total,
+		Distances:      result.Distances,
+		Suggestions:    result.Suggestions,
+		CorrectedQuery: result.CorrectedQuery,
+		Hardware:       hardware,
+	}, nil
+}
+
+func (s *SearchServiceServer) IndexHardwareStream(stream searchpb.SearchService_IndexHardwareStreamServer) error {
+	ctx := stream.Context()
+
+	if err := s.HardwareSearch.EnsureIndexHardware(ctx); err != nil {
+		return status.Error(codes.Internal, "failed to ensure index")
+	}
+
+	indexer, err := s.HardwareSearch.NewHardwareIndexer()
+	if err != nil {
+		return status.Error(codes.Internal, "failed to start indexer")
+	}
+
+	summary, err := receiveAndIndex(ctx, indexer, func() ([]*searchpb.Hardware, error) {
+		req, err := stream.Recv()
+		return req.GetHardware(), err
+	})
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(summary)
+}
+
+func (s *SearchServiceServer) ExportHardware(req *searchpb.ExportHardwareRequest, stream searchpb.SearchService_ExportHardwareServer) error {
+	ctx := stream.Context()
+
+	err := s.HardwareSearch.ExportHardware(ctx, req.Search, req.SearchFilter, req.GetBatchSize(), func(result *search.SearchResult) error {
+		batch := &searchpb.ExportHardwareBatch{
+			HardwareIDs: result.IDs,
+			Total:       result.Total,
+		}
+
+		if req.Search.GetIncludeSource() {
+			hardware, err := search.DecodeSources[searchpb.Hardware](result.Sources)
+			if err != nil {
+				return err
+			}
+
+			batch.Hardware = hardware
+		}
+
+		return stream.Send(batch)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+
+		return searchError(err, "failed to export hardware")
 	}
 
-	return &searchpb.SearchHardwareResponse{HardwareIDs: ids, Total: total}, nil
+	return nil
+}
+
+func (s *SearchServiceServer) PatchHardware(ctx context.Context, req *searchpb.HardwarePatch) (*searchpb.Empty, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := s.HardwareSearch.EnsureIndexHardware(ctx); err != nil {
+		return nil, status.Error(codes.Internal, "failed to ensure index")
+	}
+
+	if err := s.HardwareSearch.PatchHardware(ctx, req); err != nil {
+		if errors.Is(err, search.ErrEmptyPatch) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		if errors.Is(err, search.ErrDocumentNotFound) {
+			return nil, status.Error(codes.NotFound, "hardware not found")
+		}
+
+		return nil, status.Error(codes.Internal, "failed to patch hardware")
+	}
+
+	return &searchpb.Empty{}, nil
 }
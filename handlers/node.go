@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"search-service/proto/searchpb"
+	"search-service/search"
+	"time"
 )
 
 func (s *SearchServiceServer) IndexNode(ctx context.Context, req *searchpb.Node) (*searchpb.Empty, error) {
@@ -28,10 +31,106 @@ func (s *SearchServiceServer) IndexNodes(ctx context.Context, req *searchpb.Inde
 }
 
 func (s *SearchServiceServer) SearchNodes(ctx context.Context, req *searchpb.SearchNodesRequest) (*searchpb.SearchNodesResponse, error) {
-	ids, total, err := s.NodeSearch.SearchNodes(ctx, req.Search, req.SearchFilter)
+	started := time.Now()
+
+	result, err := s.NodeSearch.SearchNodes(ctx, req.Search, req.SearchFilter)
+	if err != nil {
+		return nil, searchError(err, "failed to search nodes")
+	}
+
+	s.recordSearch(ctx, "node", req.Search.GetQuery(), req.SearchFilter, result.Total, started)
+
+	var nodes []*searchpb.Node
+	if req.Search.GetIncludeSource() {
+		if nodes, err = search.DecodeSources[searchpb.Node](result.Sources); err != nil {
+			return nil, status.Error(codes.Internal, "failed to decode nodes")
+		}
+	}
+
+	return &searchpb.SearchNodesResponse{
+		NodesIDs:       result.IDs,
+		Total:          result.Total,
+		Distances:      result.Distances,
+		Suggestions:    result.Suggestions,
+		CorrectedQuery: result.CorrectedQuery,
+		Nodes:          nodes,
+	}, nil
+}
+
+func (s *SearchServiceServer) IndexNodesStream(stream searchpb.SearchService_IndexNodesStreamServer) error {
+	ctx := stream.Context()
+
+	if err := s.NodeSearch.EnsureIndexNode(ctx); err != nil {
+		return status.Error(codes.Internal, "failed to ensure index")
+	}
+
+	indexer, err := s.NodeSearch.NewNodeIndexer()
+	if err != nil {
+		return status.Error(codes.Internal, "failed to start indexer")
+	}
+
+	summary, err := receiveAndIndex(ctx, indexer, func() ([]*searchpb.Node, error) {
+		req, err := stream.Recv()
+		return req.GetNodes(), err
+	})
 	if err != nil {
-		return nil, status.Error(codes.Internal, "failed to search nodes")
+		return err
 	}
 
-	return &searchpb.SearchNodesResponse{NodesIDs: ids, Total: total}, nil
+	return stream.SendAndClose(summary)
+}
+
+func (s *SearchServiceServer) ExportNodes(req *searchpb.ExportNodesRequest, stream searchpb.SearchService_ExportNodesServer) error {
+	ctx := stream.Context()
+
+	err := s.NodeSearch.ExportNodes(ctx, req.Search, req.SearchFilter, req.GetBatchSize(), func(result *search.SearchResult) error {
+		batch := &searchpb.ExportNodesBatch{
+			NodesIDs: result.IDs,
+			Total:    result.Total,
+		}
+
+		if req.Search.GetIncludeSource() {
+			nodes, err := search.DecodeSources[searchpb.Node](result.Sources)
+			if err != nil {
+				return err
+			}
+
+			batch.Nodes = nodes
+		}
+
+		return stream.Send(batch)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+
+		return searchError(err, "failed to export nodes")
+	}
+
+	return nil
+}
+
+func (s *SearchServiceServer) PatchNode(ctx context.Context, req *searchpb.NodePatch) (*searchpb.Empty, error) {
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := s.NodeSearch.EnsureIndexNode(ctx); err != nil {
+		return nil, status.Error(codes.Internal, "failed to ensure index")
+	}
+
+	if err := s.NodeSearch.PatchNode(ctx, req); err != nil {
+		if errors.Is(err, search.ErrEmptyPatch) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		if errors.Is(err, search.ErrDocumentNotFound) {
+			return nil, status.Error(codes.NotFound, "node not found")
+		}
+
+		return nil, status.Error(codes.Internal, "failed to patch node")
+	}
+
+	return &searchpb.Empty{}, nil
 }
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"search-service/search"
+)
+
+// searchError отдаёт клиенту ошибку синтаксиса запроса как есть, остальное - как Internal
+func searchError(err error, message string) error {
+	var syntaxErr *search.QuerySyntaxError
+	if errors.As(err, &syntaxErr) {
+		return status.Error(codes.InvalidArgument, syntaxErr.Error())
+	}
+
+	return status.Error(codes.Internal, message)
+}
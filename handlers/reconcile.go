@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"search-service/proto/searchpb"
+	"search-service/search"
+)
+
+// Reconcile принимает эталонный набор id потоком сообщений; entity, fix и force берутся из первого сообщения
+func (s *SearchServiceServer) Reconcile(stream searchpb.SearchService_ReconcileServer) error {
+	ctx := stream.Context()
+
+	var entity searchpb.Entity
+	var fix, force bool
+	source := make(map[int32]int64)
+
+	for first := true; ; first = false {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if first {
+			entity, fix, force = req.GetEntity(), req.GetFix(), req.GetForce()
+		}
+
+		for _, item := range req.GetItems() {
+			source[item.GetId()] = item.GetUpdatedAt()
+		}
+	}
+
+	if entity == searchpb.Entity_ENTITY_UNSPECIFIED {
+		return status.Error(codes.InvalidArgument, "entity is required")
+	}
+
+	report, err := s.Reconciler.Reconcile(ctx, entity, source, fix, force)
+	if errors.Is(err, search.ErrUnsafeReconcile) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return status.Error(codes.Internal, "failed to reconcile")
+	}
+
+	return stream.SendAndClose(&searchpb.ReconcileReport{
+		MissingIDs:      report.Missing,
+		ExtraIDs:        report.Extra,
+		StaleIDs:        report.Stale,
+		Deleted:         report.Deleted,
+		ResendRequested: report.ResendRequested,
+	})
+}
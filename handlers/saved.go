@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"search-service/proto/searchpb"
+	"search-service/search"
+	"strings"
+)
+
+func (s *SearchServiceServer) SaveSearch(ctx context.Context, req *searchpb.SavedSearch) (*searchpb.SavedSearch, error) {
+	if req.GetOwner() == "" {
+		return nil, status.Error(codes.InvalidArgument, "owner is required")
+	}
+
+	if strings.TrimSpace(req.GetName()) == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	// Хранится только запрос той сущности, которую ищем
+	switch req.GetEntity() {
+	case searchpb.Entity_ENTITY_NODE:
+		if req.GetNodes() == nil {
+			return nil, status.Error(codes.InvalidArgument, "nodes request is required")
+		}
+		req.Hardware = nil
+	case searchpb.Entity_ENTITY_HARDWARE:
+		if req.GetHardware() == nil {
+			return nil, status.Error(codes.InvalidArgument, "hardware request is required")
+		}
+		req.Nodes = nil
+	default:
+		return nil, status.Error(codes.InvalidArgument, "entity must be node or hardware")
+	}
+
+	if err := s.SavedSearches.EnsureIndexSavedSearch(ctx); err != nil {
+		return nil, status.Error(codes.Internal, "failed to ensure index")
+	}
+
+	saved, err := s.SavedSearches.SaveSearch(ctx, req)
+	if err != nil {
+		return nil, savedSearchError(err, "failed to save search")
+	}
+
+	return saved, nil
+}
+
+func (s *SearchServiceServer) ListSavedSearches(ctx context.Context, req *searchpb.ListSavedSearchesRequest) (*searchpb.ListSavedSearchesResponse, error) {
+	if req.GetOwner() == "" {
+		return nil, status.Error(codes.InvalidArgument, "owner is required")
+	}
+
+	searches, err := s.SavedSearches.ListSavedSearches(ctx, req.GetOwner(), req.GetEntity())
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list saved searches")
+	}
+
+	return &searchpb.ListSavedSearchesResponse{Searches: searches}, nil
+}
+
+// RunSavedSearch выполняет сохранённый запрос заново по текущим данным.
+// offset и limit из запроса, если заданы, заменяют сохранённые
+func (s *SearchServiceServer) RunSavedSearch(ctx context.Context, req *searchpb.RunSavedSearchRequest) (*searchpb.RunSavedSearchResponse, error) {
+	if req.GetId() == "" || req.GetOwner() == "" {
+		return nil, status.Error(codes.InvalidArgument, "id and owner are required")
+	}
+
+	saved, err := s.SavedSearches.GetSavedSearch(ctx, req.GetId(), req.GetOwner())
+	if err != nil {
+		return nil, savedSearchError(err, "failed to get saved search")
+	}
+
+	resp := &searchpb.RunSavedSearchResponse{Search: saved}
+
+	switch saved.GetEntity() {
+	case searchpb.Entity_ENTITY_NODE:
+		nodesReq := saved.GetNodes()
+		if nodesReq == nil {
+			nodesReq = &searchpb.SearchNodesRequest{}
+		}
+		nodesReq.Search = withPage(nodesReq.GetSearch(), req.GetOffset(), req.GetLimit())
+
+		if resp.Nodes, err = s.SearchNodes(ctx, nodesReq); err != nil {
+			return nil, err
+		}
+	case searchpb.Entity_ENTITY_HARDWARE:
+		hardwareReq := saved.GetHardware()
+		if hardwareReq == nil {
+			hardwareReq = &searchpb.SearchHardwareRequest{}
+		}
+		hardwareReq.Search = withPage(hardwareReq.GetSearch(), req.GetOffset(), req.GetLimit())
+
+		if resp.Hardware, err = s.SearchHardware(ctx, hardwareReq); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, status.Error(codes.FailedPrecondition, "saved search has unsupported entity")
+	}
+
+	return resp, nil
+}
+
+func (s *SearchServiceServer) DeleteSavedSearch(ctx context.Context, req *searchpb.DeleteSavedSearchRequest) (*searchpb.Empty, error) {
+	if req.GetId() == "" || req.GetOwner() == "" {
+		return nil, status.Error(codes.InvalidArgument, "id and owner are required")
+	}
+
+	if err := s.SavedSearches.DeleteSavedSearch(ctx, req.GetId(), req.GetOwner()); err != nil {
+		return nil, savedSearchError(err, "failed to delete saved search")
+	}
+
+	return &searchpb.Empty{}, nil
+}
+
+func withPage(search *searchpb.Search, offset, limit int32) *searchpb.Search {
+	if search == nil {
+		search = &searchpb.Search{}
+	}
+
+	if offset > 0 {
+		search.Offset = offset
+	}
+
+	if limit > 0 {
+		search.Limit = limit
+	}
+
+	return search
+}
+
+func savedSearchError(err error, message string) error {
+	if errors.Is(err, search.ErrSavedSearchNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+
+	return searchError(err, message)
+}
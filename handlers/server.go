@@ -10,4 +10,10 @@ type SearchServiceServer struct {
 	NodeSearch     search.NodeSearch
 	HardwareSearch search.HardwareSearch
 	AddressSearch  search.AddressSearch
+	StreetSearch   search.StreetSearch
+	GlobalSearch   search.GlobalSearch
+	Suggester      search.Suggester
+	Reconciler     search.Reconciler
+	SavedSearches  search.SavedSearchStore
+	Analytics      search.SearchAnalytics
 }
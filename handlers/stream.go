@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"log"
+	"search-service/proto/searchpb"
+	"search-service/search"
+	"strconv"
+)
+
+func receiveAndIndex[T any](ctx context.Context, indexer *search.StreamIndexer[T], recv func() ([]T, error)) (*searchpb.IndexSummary, error) {
+	for {
+		items, err := recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, closeErr := indexer.Close(ctx); closeErr != nil {
+				log.Println(closeErr)
+			}
+			return nil, err
+		}
+
+		for _, item := range items {
+			if err = indexer.Add(ctx, item); err != nil {
+				if _, closeErr := indexer.Close(ctx); closeErr != nil {
+					log.Println(closeErr)
+				}
+				return nil, status.Error(codes.Internal, "failed to index")
+			}
+		}
+	}
+
+	summary, err := indexer.Close(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, status.Error(codes.Internal, "failed to flush index")
+	}
+
+	return &searchpb.IndexSummary{
+		Indexed:   summary.Indexed,
+		Skipped:   summary.Skipped,
+		Failed:    summary.Failed,
+		FailedIDs: failedIDs(summary.FailedIDs),
+	}, nil
+}
+
+// У сущностей, которые индексируются через стрим, ID всегда число
+func failedIDs(ids []string) []int32 {
+	result := make([]int32, 0, len(ids))
+	for _, id := range ids {
+		if value, err := strconv.Atoi(id); err == nil {
+			result = append(result, int32(value))
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"search-service/proto/searchpb"
+)
+
+func (s *SearchServiceServer) IndexStreet(ctx context.Context, req *searchpb.Street) (*searchpb.Empty, error) {
+	if err := s.StreetSearch.IndexStreet(ctx, req); err != nil {
+		return nil, status.Error(codes.Internal, "failed to index street")
+	}
+
+	return &searchpb.Empty{}, nil
+}
+
+func (s *SearchServiceServer) IndexStreets(ctx context.Context, req *searchpb.IndexStreetsRequest) (*searchpb.Empty, error) {
+	if err := s.StreetSearch.EnsureIndexStreet(ctx); err != nil {
+		return nil, status.Error(codes.Internal, "failed to ensure index")
+	}
+
+	if err := s.StreetSearch.IndexStreets(ctx, req.Streets); err != nil {
+		return nil, status.Error(codes.Internal, "failed to index streets")
+	}
+
+	return &searchpb.Empty{}, nil
+}
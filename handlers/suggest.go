@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"search-service/proto/searchpb"
+	"strings"
+)
+
+func (s *SearchServiceServer) Suggest(ctx context.Context, req *searchpb.SuggestRequest) (*searchpb.SuggestResponse, error) {
+	if req.GetEntity() == searchpb.Entity_ENTITY_UNSPECIFIED {
+		return nil, status.Error(codes.InvalidArgument, "entity is required")
+	}
+
+	if strings.TrimSpace(req.GetPrefix()) == "" {
+		return &searchpb.SuggestResponse{}, nil
+	}
+
+	suggestions, err := s.Suggester.Suggest(ctx, req)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to suggest")
+	}
+
+	return &searchpb.SuggestResponse{Suggestions: suggestions}, nil
+}
@@ -26,3 +26,21 @@ func LoggingInterceptor() grpc.UnaryServerInterceptor {
 		return resp, err
 	}
 }
+
+func StreamLoggingInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+
+		statusCode := codes.OK
+		if err != nil {
+			log.Println(err)
+			st, _ := status.FromError(err)
+			statusCode = st.Code()
+		}
+
+		message := fmt.Sprintf("method=%s status=%s", info.FullMethod, statusCode)
+		log.Println(message)
+
+		return err
+	}
+}
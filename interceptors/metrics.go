@@ -0,0 +1,40 @@
+package interceptors
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"search-service/metrics"
+	"time"
+)
+
+func MetricsInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		started := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		observeRequest(info.FullMethod, err, started)
+
+		return resp, err
+	}
+}
+
+func StreamMetricsInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		started := time.Now()
+
+		err := handler(srv, ss)
+
+		observeRequest(info.FullMethod, err, started)
+
+		return err
+	}
+}
+
+func observeRequest(method string, err error, started time.Time) {
+	code := status.Code(err).String()
+
+	metrics.GRPCRequests.WithLabelValues(method, code).Inc()
+	metrics.GRPCDuration.WithLabelValues(method, code).Observe(time.Since(started).Seconds())
+}
@@ -19,12 +19,13 @@ type IndexAddressMessage struct {
 	Type      string              `json:"type"`
 	Address   *searchpb.Address   `json:"address"`
 	Addresses []*searchpb.Address `json:"addresses"`
+	Cascade   bool                `json:"cascade"`
 }
 
-func NewAddressConsumer(reader *kafka.Reader, esClient *elasticsearch.Client) Consumer {
+func NewAddressConsumer(reader *kafka.Reader, esClient *elasticsearch.Client, cache *search.SearchCache) Consumer {
 	return &AddressConsumer{
 		reader:        reader,
-		AddressSearch: &search.DefaultAddressSearch{Elastic: esClient},
+		AddressSearch: &search.DefaultAddressSearch{Elastic: esClient, Cache: cache},
 	}
 }
 
@@ -35,39 +36,66 @@ func (c *AddressConsumer) Start(ctx context.Context) error {
 			return err
 		}
 
-		var msg IndexAddressMessage
-		if err = json.Unmarshal(m.Value, &msg); err != nil {
-			log.Printf("AddressConsumer: failed to unmarshal: %v\n", err)
-			continue
+		messageConsumed(c.reader, m)
+		c.handle(ctx, m)
+	}
+}
+
+// handle обрабатывает одно сообщение в спане, продолжающем трассировку продюсера
+func (c *AddressConsumer) handle(ctx context.Context, m kafka.Message) {
+	ctx, span := startConsumeSpan(ctx, m)
+	defer span.End()
+
+	var msg IndexAddressMessage
+	if err := json.Unmarshal(m.Value, &msg); err != nil {
+		log.Printf("AddressConsumer: failed to unmarshal: %v\n", err)
+		messageFailed(ctx, m)
+		return
+	}
+
+	if len(msg.Addresses) > 0 {
+		if err := c.AddressSearch.EnsureIndexAddress(ctx); err != nil {
+			log.Printf("AddressConsumer: failed to ensure index: %v\n", err)
 		}
 
-		if len(msg.Addresses) > 0 {
-			if err = c.AddressSearch.EnsureIndexAddress(ctx); err != nil {
-				log.Printf("AddressConsumer: failed to ensure index: %v\n", err)
-			}
+		indexed, err := c.AddressSearch.IndexAddresses(ctx, msg.Addresses)
+		if err != nil {
+			log.Printf("AddressConsumer: failed to index batch addresses: %v\n", err)
+			messageFailed(ctx, m)
+		}
 
-			if err = c.AddressSearch.IndexAddresses(ctx, msg.Addresses); err != nil {
-				log.Printf("AddressConsumer: failed to index batch addresses: %v\n", err)
-			}
+		// Записанные адреса распространяем и при частичной ошибке пачки
+		if msg.Cascade && len(indexed) > 0 {
+			c.cascade(ctx, indexed)
 		}
+	}
 
-		//switch msg.Type {
-		//case "single":
-		//	if msg.Address != nil {
-		//		if err = c.AddressSearch.IndexAddress(ctx, msg.Address); err != nil {
-		//			log.Printf("AddressConsumer: failed to index single address: %v\n", err)
-		//		}
-		//	}
-		//case "batch":
-		//	if len(msg.Addresses) > 0 {
-		//		if err = c.AddressSearch.IndexAddresses(ctx, msg.Addresses); err != nil {
-		//			log.Printf("AddressConsumer: failed to index batch addresses: %v\n", err)
-		//		}
-		//	}
-		//default:
-		//	log.Printf("AddressConsumer: unknown type: %s\n", msg.Type)
-		//}
+	//switch msg.Type {
+	//case "single":
+	//	if msg.Address != nil {
+	//		if err = c.AddressSearch.IndexAddress(ctx, msg.Address); err != nil {
+	//			log.Printf("AddressConsumer: failed to index single address: %v\n", err)
+	//		}
+	//	}
+	//case "batch":
+	//	if len(msg.Addresses) > 0 {
+	//		if err = c.AddressSearch.IndexAddresses(ctx, msg.Addresses); err != nil {
+	//			log.Printf("AddressConsumer: failed to index batch addresses: %v\n", err)
+	//		}
+	//	}
+	//default:
+	//	log.Printf("AddressConsumer: unknown type: %s\n", msg.Type)
+	//}
+}
+
+// cascade обновляет копии адреса в nodes и hardware; задачи отслеживаются в фоне, чтобы не тормозить чтение топика
+func (c *AddressConsumer) cascade(ctx context.Context, addresses []*searchpb.Address) {
+	tasks, err := c.AddressSearch.CascadeAddresses(ctx, addresses)
+	if err != nil {
+		log.Printf("AddressConsumer: failed to start cascade update: %v\n", err)
 	}
+
+	c.AddressSearch.WatchCascade(ctx, tasks)
 }
 
 func (c *AddressConsumer) Close() error {
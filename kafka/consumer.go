@@ -2,7 +2,11 @@ package kafka
 
 import (
 	"context"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"log"
+	"search-service/metrics"
 )
 
 type ConsumerManger interface {
@@ -42,3 +46,14 @@ func (m *DefaultConsumerManager) CloseAll() {
 		}
 	}
 }
+
+// messageConsumed учитывает прочитанное сообщение и отставание читателя от конца топика
+func messageConsumed(reader *kafka.Reader, m kafka.Message) {
+	metrics.KafkaMessages.WithLabelValues(m.Topic, "consumed").Inc()
+	metrics.KafkaLag.WithLabelValues(m.Topic).Set(float64(reader.Lag()))
+}
+
+func messageFailed(ctx context.Context, m kafka.Message) {
+	metrics.KafkaMessages.WithLabelValues(m.Topic, "failed").Inc()
+	trace.SpanFromContext(ctx).SetStatus(codes.Error, "failed to process message")
+}
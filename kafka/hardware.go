@@ -16,15 +16,16 @@ type HardwareConsumer struct {
 }
 
 type IndexHardwareMessage struct {
-	Type           string               `json:"type"`
-	HardwareSingle *searchpb.Hardware   `json:"hardware_single"`
-	Hardware       []*searchpb.Hardware `json:"hardware"`
+	Type           string                  `json:"type"`
+	HardwareSingle *searchpb.Hardware      `json:"hardware_single"`
+	Hardware       []*searchpb.Hardware    `json:"hardware"`
+	Patch          *searchpb.HardwarePatch `json:"patch"`
 }
 
-func NewHardwareConsumer(reader *kafka.Reader, esClient *elasticsearch.Client) Consumer {
+func NewHardwareConsumer(reader *kafka.Reader, esClient *elasticsearch.Client, cache *search.SearchCache) Consumer {
 	return &HardwareConsumer{
 		reader:         reader,
-		HardwareSearch: &search.DefaultHardwareSearch{Elastic: esClient},
+		HardwareSearch: &search.DefaultHardwareSearch{Elastic: esClient, Cache: cache},
 	}
 }
 
@@ -35,36 +36,60 @@ func (c *HardwareConsumer) Start(ctx context.Context) error {
 			return err
 		}
 
-		var msg IndexHardwareMessage
-		if err = json.Unmarshal(m.Value, &msg); err != nil {
-			log.Printf("HardwareConsumer: failed to unmarshal: %v\n", err)
-			continue
-		}
+		messageConsumed(c.reader, m)
+		c.handle(ctx, m)
+	}
+}
+
+// handle обрабатывает одно сообщение в спане, продолжающем трассировку продюсера
+func (c *HardwareConsumer) handle(ctx context.Context, m kafka.Message) {
+	ctx, span := startConsumeSpan(ctx, m)
+	defer span.End()
 
-		switch msg.Type {
-		case "single":
-			if msg.HardwareSingle != nil {
-				if err = c.HardwareSearch.EnsureIndexHardware(ctx); err != nil {
-					log.Printf("HardwareConsumer: failed to ensure index: %v\n", err)
-				}
+	var msg IndexHardwareMessage
+	if err := json.Unmarshal(m.Value, &msg); err != nil {
+		log.Printf("HardwareConsumer: failed to unmarshal: %v\n", err)
+		messageFailed(ctx, m)
+		return
+	}
+
+	switch msg.Type {
+	case "single":
+		if msg.HardwareSingle != nil {
+			if err := c.HardwareSearch.EnsureIndexHardware(ctx); err != nil {
+				log.Printf("HardwareConsumer: failed to ensure index: %v\n", err)
+			}
 
-				if err = c.HardwareSearch.IndexHardwareSingle(ctx, msg.HardwareSingle); err != nil {
-					log.Printf("HardwareConsumer: failed to index single hardware: %v\n", err)
-				}
+			if err := c.HardwareSearch.IndexHardwareSingle(ctx, msg.HardwareSingle); err != nil {
+				log.Printf("HardwareConsumer: failed to index single hardware: %v\n", err)
+				messageFailed(ctx, m)
+			}
+		}
+	case "batch":
+		if len(msg.Hardware) > 0 {
+			if err := c.HardwareSearch.EnsureIndexHardware(ctx); err != nil {
+				log.Printf("HardwareConsumer: failed to ensure index: %v\n", err)
+			}
+
+			if err := c.HardwareSearch.IndexHardware(ctx, msg.Hardware); err != nil {
+				log.Printf("HardwareConsumer: failed to index batch hardware: %v\n", err)
+				messageFailed(ctx, m)
+			}
+		}
+	case "patch":
+		if msg.Patch != nil {
+			if err := c.HardwareSearch.EnsureIndexHardware(ctx); err != nil {
+				log.Printf("HardwareConsumer: failed to ensure index: %v\n", err)
 			}
-		case "batch":
-			if len(msg.Hardware) > 0 {
-				if err = c.HardwareSearch.EnsureIndexHardware(ctx); err != nil {
-					log.Printf("HardwareConsumer: failed to ensure index: %v\n", err)
-				}
 
-				if err = c.HardwareSearch.IndexHardware(ctx, msg.Hardware); err != nil {
-					log.Printf("HardwareConsumer: failed to index batch hardware: %v\n", err)
-				}
+			if err := c.HardwareSearch.PatchHardware(ctx, msg.Patch); err != nil {
+				log.Printf("HardwareConsumer: failed to patch hardware: %v\n", err)
+				messageFailed(ctx, m)
 			}
-		default:
-			log.Printf("HardwareConsumer: unknown type: %s\n", msg.Type)
 		}
+	default:
+		log.Printf("HardwareConsumer: unknown type: %s\n", msg.Type)
+		messageFailed(ctx, m)
 	}
 }
 
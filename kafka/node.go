@@ -16,15 +16,16 @@ type NodeConsumer struct {
 }
 
 type IndexNodeMessage struct {
-	Type  string           `json:"type"`
-	Node  *searchpb.Node   `json:"node"`
-	Nodes []*searchpb.Node `json:"nodes"`
+	Type  string              `json:"type"`
+	Node  *searchpb.Node      `json:"node"`
+	Nodes []*searchpb.Node    `json:"nodes"`
+	Patch *searchpb.NodePatch `json:"patch"`
 }
 
-func NewNodeConsumer(reader *kafka.Reader, esClient *elasticsearch.Client) Consumer {
+func NewNodeConsumer(reader *kafka.Reader, esClient *elasticsearch.Client, cache *search.SearchCache) Consumer {
 	return &NodeConsumer{
 		reader:     reader,
-		NodeSearch: &search.DefaultNodeSearch{Elastic: esClient},
+		NodeSearch: &search.DefaultNodeSearch{Elastic: esClient, SkipRenamePropagation: search.RenamePropagationDisabled(), Cache: cache},
 	}
 }
 
@@ -35,36 +36,60 @@ func (c *NodeConsumer) Start(ctx context.Context) error {
 			return err
 		}
 
-		var msg IndexNodeMessage
-		if err = json.Unmarshal(m.Value, &msg); err != nil {
-			log.Printf("NodeConsumer: failed to unmarshal: %v\n", err)
-			continue
-		}
+		messageConsumed(c.reader, m)
+		c.handle(ctx, m)
+	}
+}
+
+// handle обрабатывает одно сообщение в спане, продолжающем трассировку продюсера
+func (c *NodeConsumer) handle(ctx context.Context, m kafka.Message) {
+	ctx, span := startConsumeSpan(ctx, m)
+	defer span.End()
 
-		switch msg.Type {
-		case "single":
-			if msg.Node != nil {
-				if err = c.NodeSearch.EnsureIndexNode(ctx); err != nil {
-					log.Printf("NodeConsumer: failed to ensure index: %v\n", err)
-				}
+	var msg IndexNodeMessage
+	if err := json.Unmarshal(m.Value, &msg); err != nil {
+		log.Printf("NodeConsumer: failed to unmarshal: %v\n", err)
+		messageFailed(ctx, m)
+		return
+	}
+
+	switch msg.Type {
+	case "single":
+		if msg.Node != nil {
+			if err := c.NodeSearch.EnsureIndexNode(ctx); err != nil {
+				log.Printf("NodeConsumer: failed to ensure index: %v\n", err)
+			}
 
-				if err = c.NodeSearch.IndexNode(ctx, msg.Node); err != nil {
-					log.Printf("NodeConsumer: failed to index single node: %v\n", err)
-				}
+			if err := c.NodeSearch.IndexNode(ctx, msg.Node); err != nil {
+				log.Printf("NodeConsumer: failed to index single node: %v\n", err)
+				messageFailed(ctx, m)
+			}
+		}
+	case "batch":
+		if len(msg.Nodes) > 0 {
+			if err := c.NodeSearch.EnsureIndexNode(ctx); err != nil {
+				log.Printf("NodeConsumer: failed to ensure index: %v\n", err)
+			}
+
+			if err := c.NodeSearch.IndexNodes(ctx, msg.Nodes); err != nil {
+				log.Printf("NodeConsumer: failed to index batch nodes: %v\n", err)
+				messageFailed(ctx, m)
+			}
+		}
+	case "patch":
+		if msg.Patch != nil {
+			if err := c.NodeSearch.EnsureIndexNode(ctx); err != nil {
+				log.Printf("NodeConsumer: failed to ensure index: %v\n", err)
 			}
-		case "batch":
-			if len(msg.Nodes) > 0 {
-				if err = c.NodeSearch.EnsureIndexNode(ctx); err != nil {
-					log.Printf("NodeConsumer: failed to ensure index: %v\n", err)
-				}
 
-				if err = c.NodeSearch.IndexNodes(ctx, msg.Nodes); err != nil {
-					log.Printf("NodeConsumer: failed to index batch nodes: %v\n", err)
-				}
+			if err := c.NodeSearch.PatchNode(ctx, msg.Patch); err != nil {
+				log.Printf("NodeConsumer: failed to patch node: %v\n", err)
+				messageFailed(ctx, m)
 			}
-		default:
-			log.Printf("NodeConsumer: unknown type: %s\n", msg.Type)
 		}
+	default:
+		log.Printf("NodeConsumer: unknown type: %s\n", msg.Type)
+		messageFailed(ctx, m)
 	}
 }
 
@@ -12,3 +12,11 @@ func NewKafkaReader(topic string) *kafka.Reader {
 		Topic:   topic,
 	})
 }
+
+func NewKafkaWriter(topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:     kafka.TCP(fmt.Sprintf("%s:%s", os.Getenv("KAFKA_ADDRESS"), os.Getenv("KAFKA_PORT"))),
+		Topic:    topic,
+		Balancer: &kafka.LeastBytes{},
+	}
+}
@@ -0,0 +1,78 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"search-service/proto/searchpb"
+)
+
+const resendChunk = 1000
+
+// ResendRequester просит источник данных заново отправить сущности в index-* топики
+type ResendRequester interface {
+	RequestResend(ctx context.Context, entity searchpb.Entity, ids []int32) error
+	Close() error
+}
+
+type ResendMessage struct {
+	Type string  `json:"type"`
+	IDs  []int32 `json:"ids"`
+}
+
+type DefaultResendRequester struct {
+	writers map[searchpb.Entity]*kafka.Writer
+}
+
+func NewResendRequester() ResendRequester {
+	return &DefaultResendRequester{
+		writers: map[searchpb.Entity]*kafka.Writer{
+			searchpb.Entity_ENTITY_NODE:     NewKafkaWriter("resend-node"),
+			searchpb.Entity_ENTITY_HARDWARE: NewKafkaWriter("resend-hardware"),
+			searchpb.Entity_ENTITY_ADDRESS:  NewKafkaWriter("resend-address"),
+		},
+	}
+}
+
+func (r *DefaultResendRequester) RequestResend(ctx context.Context, entity searchpb.Entity, ids []int32) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	writer, ok := r.writers[entity]
+	if !ok {
+		return fmt.Errorf("unsupported entity %v", entity)
+	}
+
+	var messages []kafka.Message
+	for start := 0; start < len(ids); start += resendChunk {
+		end := start + resendChunk
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		data, err := json.Marshal(ResendMessage{Type: "resend", IDs: ids[start:end]})
+		if err != nil {
+			return err
+		}
+
+		message := kafka.Message{Value: data}
+		injectTraceContext(ctx, &message)
+
+		messages = append(messages, message)
+	}
+
+	return writer.WriteMessages(ctx, messages...)
+}
+
+func (r *DefaultResendRequester) Close() error {
+	var firstErr error
+	for _, writer := range r.writers {
+		if err := writer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,86 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/segmentio/kafka-go"
+	"log"
+	"search-service/proto/searchpb"
+	"search-service/search"
+)
+
+type StreetConsumer struct {
+	reader *kafka.Reader
+	search.StreetSearch
+}
+
+type IndexStreetMessage struct {
+	Type    string             `json:"type"`
+	Street  *searchpb.Street   `json:"street"`
+	Streets []*searchpb.Street `json:"streets"`
+}
+
+func NewStreetConsumer(reader *kafka.Reader, esClient *elasticsearch.Client, cache *search.SearchCache) Consumer {
+	return &StreetConsumer{
+		reader:       reader,
+		StreetSearch: &search.DefaultStreetSearch{Elastic: esClient, Cache: cache},
+	}
+}
+
+func (c *StreetConsumer) Start(ctx context.Context) error {
+	for {
+		m, err := c.reader.ReadMessage(ctx)
+		if err != nil {
+			return err
+		}
+
+		messageConsumed(c.reader, m)
+		c.handle(ctx, m)
+	}
+}
+
+// handle обрабатывает одно сообщение в спане, продолжающем трассировку продюсера
+func (c *StreetConsumer) handle(ctx context.Context, m kafka.Message) {
+	ctx, span := startConsumeSpan(ctx, m)
+	defer span.End()
+
+	var msg IndexStreetMessage
+	if err := json.Unmarshal(m.Value, &msg); err != nil {
+		log.Printf("StreetConsumer: failed to unmarshal: %v\n", err)
+		messageFailed(ctx, m)
+		return
+	}
+
+	switch msg.Type {
+	case "single":
+		if msg.Street != nil {
+			if err := c.StreetSearch.EnsureIndexStreet(ctx); err != nil {
+				log.Printf("StreetConsumer: failed to ensure index: %v\n", err)
+			}
+
+			if err := c.StreetSearch.IndexStreet(ctx, msg.Street); err != nil {
+				log.Printf("StreetConsumer: failed to index single street: %v\n", err)
+				messageFailed(ctx, m)
+			}
+		}
+	case "batch":
+		if len(msg.Streets) > 0 {
+			if err := c.StreetSearch.EnsureIndexStreet(ctx); err != nil {
+				log.Printf("StreetConsumer: failed to ensure index: %v\n", err)
+			}
+
+			if err := c.StreetSearch.IndexStreets(ctx, msg.Streets); err != nil {
+				log.Printf("StreetConsumer: failed to index batch streets: %v\n", err)
+				messageFailed(ctx, m)
+			}
+		}
+	default:
+		log.Printf("StreetConsumer: unknown type: %s\n", msg.Type)
+		messageFailed(ctx, m)
+	}
+}
+
+func (c *StreetConsumer) Close() error {
+	return c.reader.Close()
+}
@@ -2,38 +2,89 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"search-service/cli"
 	"search-service/handlers"
 	"search-service/interceptors"
 	"search-service/kafka"
+	"search-service/metrics"
 	"search-service/proto/searchpb"
 	"search-service/search"
+	"search-service/tracing"
+	"syscall"
+	"time"
 )
 
+const metricsShutdownTimeout = 5 * time.Second
+
 func main() {
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		log.Fatalln(err)
+		return
+	}
+	defer shutdownTracing(context.Background())
+
 	esClient, err := search.NewElasticClient(fmt.Sprintf("%s:%s", os.Getenv("ELASTICSEARCH_ADDRESS"), os.Getenv("ELASTICSEARCH_PORT")))
 	if err != nil {
 		log.Fatalln(err)
 		return
 	}
 
+	// search-service import|... - разовая команда вместо запуска сервера
+	if len(os.Args) > 1 {
+		if err = cli.Run(context.Background(), esClient, os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	// Кэш общий для обработчиков и консьюмеров: запись из любого источника сбрасывает его
+	searchCache := search.NewSearchCacheFromEnv()
+	if searchCache != nil {
+		metrics.Register(searchCache)
+	}
+
 	consumerManager := kafka.NewConsumerManager([]kafka.Consumer{
-		kafka.NewNodeConsumer(kafka.NewKafkaReader("index-node"), esClient),
-		kafka.NewHardwareConsumer(kafka.NewKafkaReader("index-hardware"), esClient),
-		kafka.NewAddressConsumer(kafka.NewKafkaReader("index-address"), esClient),
+		kafka.NewNodeConsumer(kafka.NewKafkaReader("index-node"), esClient, searchCache),
+		kafka.NewHardwareConsumer(kafka.NewKafkaReader("index-hardware"), esClient, searchCache),
+		kafka.NewAddressConsumer(kafka.NewKafkaReader("index-address"), esClient, searchCache),
+		kafka.NewStreetConsumer(kafka.NewKafkaReader("index-street"), esClient, searchCache),
 	})
 
 	consumerManager.StartAll(context.Background())
 	defer consumerManager.CloseAll()
 
+	resendRequester := kafka.NewResendRequester()
+	defer resendRequester.Close()
+
+	// Без аналитики сервис работает, просто не пишет статистику поиска
+	var searchAnalytics search.SearchAnalytics = search.NopSearchAnalytics{}
+	if analytics, err := search.NewSearchAnalytics(esClient); err != nil {
+		log.Printf("Search analytics disabled: %v\n", err)
+	} else {
+		defer analytics.Close(context.Background())
+		searchAnalytics = analytics
+	}
+
 	searchService := &handlers.SearchServiceServer{
-		NodeSearch:     &search.DefaultNodeSearch{Elastic: esClient},
-		HardwareSearch: &search.DefaultHardwareSearch{Elastic: esClient},
-		AddressSearch:  &search.DefaultAddressSearch{Elastic: esClient},
+		NodeSearch:     &search.DefaultNodeSearch{Elastic: esClient, SkipRenamePropagation: search.RenamePropagationDisabled(), Cache: searchCache},
+		HardwareSearch: &search.DefaultHardwareSearch{Elastic: esClient, Cache: searchCache},
+		AddressSearch:  &search.DefaultAddressSearch{Elastic: esClient, Cache: searchCache},
+		StreetSearch:   &search.DefaultStreetSearch{Elastic: esClient, Cache: searchCache},
+		GlobalSearch:   &search.DefaultGlobalSearch{Elastic: esClient, Cache: searchCache},
+		Suggester:      &search.DefaultSuggester{Elastic: esClient, Cache: searchCache},
+		Reconciler:     &search.DefaultReconciler{Elastic: esClient, Resender: resendRequester, Cache: searchCache},
+		SavedSearches:  &search.DefaultSavedSearchStore{Elastic: esClient},
+		Analytics:      searchAnalytics,
 	}
 
 	lis, err := net.Listen(os.Getenv("APP_NETWORK"), fmt.Sprintf(":%s", os.Getenv("APP_PORT")))
@@ -43,12 +94,58 @@ func main() {
 	}
 
 	grpcServer := grpc.NewServer(
+		// Контекст трассировки приходит в метаданных запроса
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
 		grpc.ChainUnaryInterceptor(
+			interceptors.MetricsInterceptor(),
 			interceptors.LoggingInterceptor(),
 		),
+		grpc.ChainStreamInterceptor(
+			interceptors.StreamMetricsInterceptor(),
+			interceptors.StreamLoggingInterceptor(),
+		),
 	)
 
 	searchpb.RegisterSearchServiceServer(grpcServer, searchService)
+
+	metricsPort := os.Getenv("METRICS_PORT")
+	if metricsPort == "" {
+		metricsPort = "9090"
+	}
+
+	// Порт занимаем сразу, чтобы ошибка была видна при старте, а не только в логе
+	metricsListener, err := net.Listen("tcp", fmt.Sprintf(":%s", metricsPort))
+	if err != nil {
+		log.Fatalln(err)
+		return
+	}
+
+	metricsServer := metrics.NewServer()
+	go func() {
+		if err := metricsServer.Serve(metricsListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Metrics server stopped: %v\n", err)
+		}
+	}()
+
+	// По сигналу дожидаемся текущих запросов, после чего закрываются метрики и отложенные Close
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+
+		log.Println("Search-service is shutting down")
+		grpcServer.GracefulStop()
+	}()
+
 	log.Printf("Search-service started on :%s\n", os.Getenv("APP_PORT"))
-	grpcServer.Serve(lis)
+	if err = grpcServer.Serve(lis); err != nil {
+		log.Printf("Search-service stopped: %v\n", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+	defer cancel()
+
+	if err = metricsServer.Shutdown(ctx); err != nil {
+		log.Printf("Metrics server shutdown: %v\n", err)
+	}
 }
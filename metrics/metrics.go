@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+const namespace = "search_service"
+
+var (
+	GRPCRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_requests_total",
+		Help:      "gRPC requests by method and status code.",
+	}, []string{"method", "code"})
+
+	GRPCDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "gRPC request latency by method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	ElasticDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "elasticsearch_request_duration_seconds",
+		Help:      "Elasticsearch request latency by operation and index.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "index"})
+
+	// status - HTTP-код ответа или "error", если запрос не дошёл до ES
+	ElasticErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "elasticsearch_errors_total",
+		Help:      "Failed Elasticsearch requests by operation, index and status.",
+	}, []string{"operation", "index", "status"})
+
+	// result: indexed, version_conflict, failed
+	BulkDocuments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bulk_documents_total",
+		Help:      "Documents written in bulk by index and result.",
+	}, []string{"index", "result"})
+
+	VersionConflicts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "version_conflicts_total",
+		Help:      "Writes skipped because the index already holds a newer version.",
+	}, []string{"index"})
+
+	// result: consumed, failed
+	KafkaMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_messages_total",
+		Help:      "Kafka messages by topic and result.",
+	}, []string{"topic", "result"})
+
+	KafkaLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "kafka_consumer_lag",
+		Help:      "Messages behind the end of the topic after the last read.",
+	}, []string{"topic"})
+)
+
+// Register добавляет коллекторы, которые собирают значения сами (например, статистику кэша)
+func Register(collectors ...prometheus.Collector) {
+	prometheus.MustRegister(collectors...)
+}
+
+// NewServer отдаёт /metrics; запускать и останавливать его должен вызывающий вместе с gRPC-сервером
+func NewServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	return &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
+}
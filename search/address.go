@@ -6,49 +6,73 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"net/http"
+	"regexp"
 	"search-service/proto/searchpb"
 	"strconv"
+	"strings"
+	"sync/atomic"
 )
 
 type AddressSearch interface {
-	SearchAddresses(ctx context.Context, search *searchpb.SearchAddress) ([]int32, int32, error)
-	IndexAddresses(ctx context.Context, addresses []*searchpb.Address) error
+	SearchAddresses(ctx context.Context, search *searchpb.SearchAddress) (*SearchResult, error)
+	SearchStreetHouses(ctx context.Context, req *searchpb.StreetHousesRequest) (*SearchResult, error)
+	IndexAddresses(ctx context.Context, addresses []*searchpb.Address) ([]*searchpb.Address, error)
 	IndexAddress(ctx context.Context, address *searchpb.Address) error
 	EnsureIndexAddress(ctx context.Context) error
+	NewAddressIndexer() (*StreamIndexer[*searchpb.Address], error)
+	CascadeAddresses(ctx context.Context, addresses []*searchpb.Address) ([]CascadeTask, error)
+	GetCascadeTask(ctx context.Context, taskID string) (*TaskStatus, error)
+	WatchCascade(ctx context.Context, tasks []CascadeTask)
 }
 
 type DefaultAddressSearch struct {
 	Elastic *elasticsearch.Client
+	Cache   *SearchCache
+
+	// streetsReady - индекс улиц уже заполнен, проверять его больше не нужно
+	streetsReady atomic.Bool
 }
 
 func (s *DefaultAddressSearch) IndexAddress(ctx context.Context, address *searchpb.Address) error {
-	data, err := json.Marshal(address)
+	defer s.Cache.Invalidate("addresses")
+
+	data, err := json.Marshal(newAddressDocument(address))
 	if err != nil {
 		return err
 	}
 
 	req := bytes.NewReader(data)
 
-	_, err = s.Elastic.Index(
-		"addresses",
-		req,
+	opts := append([]func(*esapi.IndexRequest){
 		s.Elastic.Index.WithDocumentID(fmt.Sprint(address.HouseId)),
 		s.Elastic.Index.WithRefresh("true"),
 		s.Elastic.Index.WithContext(ctx),
-	)
+	}, indexVersionOptions(s.Elastic, address.GetUpdatedAt())...)
 
-	return err
+	res, err := s.Elastic.Index("addresses", req, opts...)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return checkIndexResponse(res, "addresses")
 }
 
-func (s *DefaultAddressSearch) IndexAddresses(ctx context.Context, addresses []*searchpb.Address) error {
+// IndexAddresses возвращает адреса, которые действительно записаны. Пропущенные как устаревшие
+// каскадом не распространяются, иначе старые данные попали бы в nodes и hardware
+func (s *DefaultAddressSearch) IndexAddresses(ctx context.Context, addresses []*searchpb.Address) ([]*searchpb.Address, error) {
+	defer s.Cache.Invalidate("addresses")
+
 	var buf bytes.Buffer
 
 	for _, address := range addresses {
-		meta := []byte(fmt.Sprintf(`{ "index" : { "_id" : "%d" } }%s`, address.HouseId, "\n"))
+		meta := bulkIndexMeta(address.HouseId, address.GetUpdatedAt())
 
-		data, err := json.Marshal(address)
+		data, err := json.Marshal(newAddressDocument(address))
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		data = append(data, '\n')
@@ -65,28 +89,375 @@ func (s *DefaultAddressSearch) IndexAddresses(ctx context.Context, addresses []*
 		s.Elastic.Bulk.WithRefresh("true"),
 		s.Elastic.Bulk.WithContext(ctx),
 	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	written, err := decodeBulkResponse(res)
+
+	var indexed []*searchpb.Address
+	for _, address := range addresses {
+		if written[fmt.Sprint(address.HouseId)] {
+			indexed = append(indexed, address)
+		}
+	}
+
+	return indexed, err
+}
+
+// Уровень выдачи (дома или улицы) зависит от запроса, поэтому кэш сбрасывается по обоим индексам
+func (s *DefaultAddressSearch) SearchAddresses(ctx context.Context, search *searchpb.SearchAddress) (*SearchResult, error) {
+	return cachedSearch(s.Cache, "addresses", []string{"addresses", "streets"}, search, search.GetBypassCache(), func() (*SearchResult, error) {
+		return s.searchAddressesOrStreets(ctx, search)
+	})
+}
+
+func (s *DefaultAddressSearch) searchAddressesOrStreets(ctx context.Context, search *searchpb.SearchAddress) (*SearchResult, error) {
+	var parsed *searchpb.ParsedAddress
+
+	if search.GetQuery() != "" && search.GetStreetQuery() == "" && search.GetHouseQuery() == "" {
+		parsed = ParseAddress(search.GetQuery())
+		search = withParsedAddress(search, parsed)
+	}
+
+	run, index, fields := s.searchAddresses, "addresses", addressSpellFields
+
+	// Без номера дома ищем по индексу улиц, чтобы каждая улица была в выдаче один раз.
+	// Гео-фильтры и сортировка по расстоянию есть только у домов
+	streetLevel := search.GetHouseQuery() == "" && search.GetNear() == nil && search.GetGeo() == nil
+	if streetLevel {
+		ready, err := s.hasStreets(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// Пока индекс улиц не создан или пуст, собираем улицы из домов
+		if ready {
+			run, index, fields = s.searchStreets, "streets", streetSpellFields
+		} else {
+			run = s.searchStreetsFromAddresses
+		}
+	}
+
+	result, err := run(ctx, search)
+	if err == nil && result.Total == 0 && strings.TrimSpace(search.GetStreetQuery()) != "" {
+		result, err = correctZeroResults(ctx, s.Elastic, index, fields, search.GetStreetQuery(), search.GetAutoCorrect(), result, func(query string) (*SearchResult, error) {
+			return run(ctx, withStreetQuery(search, query))
+		})
+
+		// Исправляется только улица, а клиенту нужен запрос целиком, с типом улицы и домом
+		if err == nil && result.CorrectedQuery != "" && parsed != nil {
+			result.CorrectedQuery = joinAddressQuery(search.GetStreetType(), result.CorrectedQuery, search.GetHouseQuery())
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	result.ParsedAddress = parsed
+	result.StreetLevel = streetLevel
+
+	return result, nil
+}
+
+func (s *DefaultAddressSearch) searchAddresses(ctx context.Context, search *searchpb.SearchAddress) (*SearchResult, error) {
+	searchQuery := buildAddressSearchQuery(search)
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(searchQuery); err != nil {
+		return nil, err
+	}
+
+	res, err := s.Elastic.Search(
+		s.Elastic.Search.WithContext(ctx),
+		s.Elastic.Search.WithIndex("addresses"),
+		s.Elastic.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return decodeSearchResult(res, search.GetNear() != nil)
+}
+
+func (s *DefaultAddressSearch) searchStreets(ctx context.Context, search *searchpb.SearchAddress) (*SearchResult, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(buildStreetSearchQuery(search)); err != nil {
+		return nil, err
+	}
+
+	res, err := s.Elastic.Search(
+		s.Elastic.Search.WithContext(ctx),
+		s.Elastic.Search.WithIndex("streets"),
+		s.Elastic.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return decodeSearchResult(res, false)
+}
+
+func (s *DefaultAddressSearch) hasStreets(ctx context.Context) (bool, error) {
+	if s.streetsReady.Load() {
+		return true, nil
+	}
+
+	res, err := s.Elastic.Count(
+		s.Elastic.Count.WithContext(ctx),
+		s.Elastic.Count.WithIndex("streets"),
+	)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	if res.IsError() {
+		return false, fmt.Errorf("count streets failed: %s", res.String())
+	}
+
+	var r struct {
+		Count int64 `json:"count"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return false, err
+	}
+
+	if r.Count == 0 {
+		return false, nil
+	}
+
+	s.streetsReady.Store(true)
+
+	return true, nil
+}
+
+func (s *DefaultAddressSearch) searchStreetsFromAddresses(ctx context.Context, search *searchpb.SearchAddress) (*SearchResult, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(buildStreetAggregationQuery(search)); err != nil {
+		return nil, err
+	}
+
+	res, err := s.Elastic.Search(
+		s.Elastic.Search.WithContext(ctx),
+		s.Elastic.Search.WithIndex("addresses"),
+		s.Elastic.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return decodeStreetAggregation(res, search.GetOffset(), search.GetLimit())
+}
+
+func (s *DefaultAddressSearch) SearchStreetHouses(ctx context.Context, req *searchpb.StreetHousesRequest) (*SearchResult, error) {
+	return cachedSearch(s.Cache, "street_houses", []string{"addresses"}, req, req.GetBypassCache(), func() (*SearchResult, error) {
+		return s.searchStreetHouses(ctx, req)
+	})
+}
+
+func (s *DefaultAddressSearch) searchStreetHouses(ctx context.Context, req *searchpb.StreetHousesRequest) (*SearchResult, error) {
+	searchQuery := map[string]interface{}{
+		"from": req.GetOffset(),
+		"size": req.GetLimit(),
+		"query": map[string]interface{}{
+			"term": map[string]interface{}{
+				"street_id": req.GetStreetId(),
+			},
+		},
+		"sort":             houseSort(),
+		"track_total_hits": true,
+	}
+
+	applySourceFilter(searchQuery, req.GetIncludeSource(), req.GetFields())
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(searchQuery); err != nil {
+		return nil, err
+	}
+
+	res, err := s.Elastic.Search(
+		s.Elastic.Search.WithContext(ctx),
+		s.Elastic.Search.WithIndex("addresses"),
+		s.Elastic.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return decodeSearchResult(res, false)
+}
+
+func (s *DefaultAddressSearch) NewAddressIndexer() (*StreamIndexer[*searchpb.Address], error) {
+	return newStreamIndexer(s.Elastic, s.Cache, "addresses",
+		func(address *searchpb.Address) string { return fmt.Sprint(address.GetHouseId()) },
+		func(address *searchpb.Address) interface{} { return newAddressDocument(address) },
+		func(address *searchpb.Address) int64 { return address.GetUpdatedAt() },
+	)
+}
+
+func (s *DefaultAddressSearch) EnsureIndexAddress(ctx context.Context) error {
+	res, err := s.Elastic.Indices.Exists([]string{"addresses"}, s.Elastic.Indices.Exists.WithContext(ctx))
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
-	var bulkResp struct {
-		Errors bool `json:"errors"`
+	exists := res.StatusCode == 200
+
+	//fieldParams := map[string]interface{}{
+	//	"type": "text",
+	//	"fields": map[string]interface{}{
+	//		"edge": map[string]interface{}{
+	//			"type":            "text",
+	//			"analyzer":        "edge_ngram_analyzer",
+	//			"search_analyzer": "standard",
+	//		},
+	//	},
+	//}
+	//
+	//settings := map[string]interface{}{
+	//	"settings": map[string]interface{}{
+	//		"analysis": map[string]interface{}{
+	//			"filter": map[string]interface{}{
+	//				"edge_ngram_filter": map[string]interface{}{
+	//					"type":     "edge_ngram",
+	//					"min_gram": 2,
+	//					"max_gram": 20,
+	//				},
+	//			},
+	//			"analyzer": map[string]interface{}{
+	//				"edge_ngram_analyzer": map[string]interface{}{
+	//					"type":      "custom",
+	//					"tokenizer": "standard",
+	//					"filter":    []string{"lowercase", "edge_ngram_filter"},
+	//				},
+	//			},
+	//		},
+	//	},
+	//	"mappings": map[string]interface{}{
+	//		"properties": map[string]interface{}{
+	//			"street_name": fieldParams,
+	//			"street_type": fieldParams,
+	//			"house_name":  fieldParams,
+	//			"house_type":  fieldParams,
+	//		},
+	//	},
+	//}
+
+	settings := map[string]interface{}{
+		"settings": map[string]interface{}{
+			"analysis": map[string]interface{}{
+				"filter": map[string]interface{}{
+					"edge_ngram_filter": map[string]interface{}{
+						"type":     "edge_ngram",
+						"min_gram": 1,
+						"max_gram": 20,
+					},
+				},
+				"analyzer": map[string]interface{}{
+					"edge_ngram_analyzer": map[string]interface{}{
+						"type":      "custom",
+						"tokenizer": "standard",
+						"filter":    []string{"lowercase", "edge_ngram_filter"},
+					},
+					"completion_analyzer": completionAnalyzer,
+				},
+			},
+		},
+		"mappings": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"street_name": map[string]interface{}{
+					"type": "text",
+					"fields": map[string]interface{}{
+						"edge": map[string]interface{}{
+							"type":            "text",
+							"analyzer":        "edge_ngram_analyzer",
+							"search_analyzer": "standard", // Для точного поиска при вводе
+						},
+						"keyword": map[string]interface{}{
+							"type": "keyword", // Для точной сортировки
+						},
+					},
+				},
+				"street_type_short_name": map[string]interface{}{
+					"type": "keyword",
+				},
+				"house_name": map[string]interface{}{
+					"type": "text",
+					"fields": map[string]interface{}{
+						"edge": map[string]interface{}{
+							"type":            "text",
+							"analyzer":        "edge_ngram_analyzer",
+							"search_analyzer": "standard",
+						},
+						"keyword": map[string]interface{}{
+							"type": "keyword",
+						},
+					},
+				},
+				"house_type_short_name": map[string]interface{}{
+					"type": "keyword",
+				},
+				"street_id": map[string]interface{}{
+					"type": "integer",
+				},
+				"region":   adminKeywordMapping,
+				"district": adminKeywordMapping,
+				"locality": adminKeywordMapping,
+				"house_number": map[string]interface{}{
+					"type": "integer",
+				},
+				"house_suffix": map[string]interface{}{
+					"type": "keyword",
+				},
+				"house_building": map[string]interface{}{
+					"type": "keyword",
+				},
+				"house_canonical": map[string]interface{}{
+					"type": "keyword",
+				},
+				"location":   geoPointMapping,
+				"suggest":    completionMapping(),
+				"updated_at": updatedAtMapping,
+			},
+		},
+	}
+
+	if exists {
+		return putMissingMappings(ctx, s.Elastic, "addresses", settings)
 	}
 
-	if err = json.NewDecoder(res.Body).Decode(&bulkResp); err != nil {
+	var buf bytes.Buffer
+	if err = json.NewEncoder(&buf).Encode(settings); err != nil {
 		return err
 	}
 
-	if bulkResp.Errors {
-		return fmt.Errorf("bulk indexing had errors")
+	createRes, err := s.Elastic.Indices.Create(
+		"addresses",
+		s.Elastic.Indices.Create.WithBody(&buf),
+		s.Elastic.Indices.Create.WithContext(ctx),
+	)
+	if err != nil {
+		return err
 	}
+	defer createRes.Body.Close()
 
 	return nil
 }
 
-func (s *DefaultAddressSearch) SearchAddresses(ctx context.Context, search *searchpb.SearchAddress) ([]int32, int32, error) {
-
+func buildAddressSearchQuery(search *searchpb.SearchAddress) map[string]interface{} {
 	//searchQuery := map[string]interface{}{
 	//	"from": search.Offset,
 	//	"size": search.Limit,
@@ -115,6 +486,21 @@ func (s *DefaultAddressSearch) SearchAddresses(ctx context.Context, search *sear
 	//}
 	var searchQuery map[string]interface{}
 
+	sort := append([]map[string]interface{}{
+		{
+			"_score": map[string]interface{}{
+				"order": "desc",
+			},
+		},
+	}, houseSort()...)
+
+	houseCanonical := canonicalHouse(search.HouseQuery)
+
+	near := search.GetNear()
+	if near != nil {
+		sort = append([]map[string]interface{}{buildGeoDistanceSort("location", near)}, sort...)
+	}
+
 	if search.HouseQuery == "" {
 		searchQuery = map[string]interface{}{
 			"from": search.Offset,
@@ -127,22 +513,7 @@ func (s *DefaultAddressSearch) SearchAddresses(ctx context.Context, search *sear
 					},
 				},
 			},
-			"_source": []string{
-				"street_name",
-				"street_type_short_name",
-			},
-			"sort": []map[string]interface{}{
-				{
-					"_score": map[string]interface{}{
-						"order": "desc",
-					},
-				},
-				{
-					"house_name.keyword": map[string]interface{}{
-						"order": "asc",
-					},
-				},
-			},
+			"sort": sort,
 		}
 	} else {
 		searchQuery = map[string]interface{}{
@@ -201,7 +572,7 @@ func (s *DefaultAddressSearch) SearchAddresses(ctx context.Context, search *sear
 						{
 							"filter": map[string]interface{}{
 								"term": map[string]interface{}{
-									"house_name.keyword": search.HouseQuery,
+									"house_canonical": houseCanonical,
 								},
 							},
 							"weight": 100,
@@ -212,12 +583,12 @@ func (s *DefaultAddressSearch) SearchAddresses(ctx context.Context, search *sear
 									"must": []map[string]interface{}{
 										{
 											"prefix": map[string]interface{}{
-												"house_name.keyword": search.HouseQuery,
+												"house_canonical": houseCanonical,
 											},
 										},
 										{
 											"regexp": map[string]interface{}{
-												"house_name.keyword": search.HouseQuery + "[^0-9].*",
+												"house_canonical": regexp.QuoteMeta(houseCanonical) + "[^0-9].*",
 											},
 										},
 									},
@@ -257,188 +628,104 @@ func (s *DefaultAddressSearch) SearchAddresses(ctx context.Context, search *sear
 					"score_mode": "sum",
 				},
 			},
-			"sort": []map[string]interface{}{
-				{
-					"_score": map[string]interface{}{
-						"order": "desc",
-					},
-				},
-				{
-					"house_name.keyword": map[string]interface{}{
-						"order": "asc",
-					},
-				},
-			},
+			"sort":             sort,
 			"track_total_hits": true,
 		}
 	}
 
-	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(searchQuery); err != nil {
-		return nil, 0, err
-	}
+	filters := buildGeoFilter("location", search.GetGeo())
+	filters = append(filters, buildAdminFilter("", search.GetAdmin())...)
 
-	res, err := s.Elastic.Search(
-		s.Elastic.Search.WithContext(ctx),
-		s.Elastic.Search.WithIndex("addresses"),
-		s.Elastic.Search.WithBody(&buf),
-	)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer res.Body.Close()
+	should := buildAdminBoost("", search.GetPreferAdmin())
 
-	var r struct {
-		Hits struct {
-			Total struct {
-				Value int32 `json:"value"`
-			} `json:"total"`
-			Hits []struct {
-				ID string `json:"_id"`
-			} `json:"hits"`
-		} `json:"hits"`
+	// Тип улицы только поднимает совпадения, а не отсекает: в индексе он заполнен не везде
+	if streetType := search.GetStreetType(); streetType != "" {
+		should = append(should, map[string]interface{}{
+			"term": map[string]interface{}{
+				"street_type_short_name": map[string]interface{}{
+					"value": streetType,
+					"boost": 2,
+				},
+			},
+		})
 	}
 
-	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
-		return nil, 0, err
-	}
+	if len(filters) > 0 || len(should) > 0 {
+		boolQuery := map[string]interface{}{
+			"must": searchQuery["query"],
+		}
 
-	var ids []int32
+		if len(filters) > 0 {
+			boolQuery["filter"] = filters
+		}
 
-	for _, hit := range r.Hits.Hits {
-		id, err := strconv.Atoi(hit.ID)
-		if err != nil {
-			return nil, 0, fmt.Errorf("invalid id %s: %v", hit.ID, err)
+		if len(should) > 0 {
+			boolQuery["should"] = should
 		}
 
-		ids = append(ids, int32(id))
+		searchQuery["query"] = map[string]interface{}{
+			"bool": boolQuery,
+		}
 	}
 
-	return ids, r.Hits.Total.Value, nil
-}
-
-func (s *DefaultAddressSearch) EnsureIndexAddress(ctx context.Context) error {
-	res, err := s.Elastic.Indices.Exists([]string{"addresses"}, s.Elastic.Indices.Exists.WithContext(ctx))
-	if err != nil {
-		return err
+	// Одна и та же улица может быть в нескольких населённых пунктах - отдаём группы для уточнения
+	if search.GetAdminFacets() {
+		searchQuery["aggs"] = map[string]interface{}{
+			"admin": buildAdminAggregation(""),
+		}
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode == 200 {
-		return nil
-	}
+	applySourceFilter(searchQuery, search.GetIncludeSource(), search.GetFields())
 
-	//fieldParams := map[string]interface{}{
-	//	"type": "text",
-	//	"fields": map[string]interface{}{
-	//		"edge": map[string]interface{}{
-	//			"type":            "text",
-	//			"analyzer":        "edge_ngram_analyzer",
-	//			"search_analyzer": "standard",
-	//		},
-	//	},
-	//}
-	//
-	//settings := map[string]interface{}{
-	//	"settings": map[string]interface{}{
-	//		"analysis": map[string]interface{}{
-	//			"filter": map[string]interface{}{
-	//				"edge_ngram_filter": map[string]interface{}{
-	//					"type":     "edge_ngram",
-	//					"min_gram": 2,
-	//					"max_gram": 20,
-	//				},
-	//			},
-	//			"analyzer": map[string]interface{}{
-	//				"edge_ngram_analyzer": map[string]interface{}{
-	//					"type":      "custom",
-	//					"tokenizer": "standard",
-	//					"filter":    []string{"lowercase", "edge_ngram_filter"},
-	//				},
-	//			},
-	//		},
-	//	},
-	//	"mappings": map[string]interface{}{
-	//		"properties": map[string]interface{}{
-	//			"street_name": fieldParams,
-	//			"street_type": fieldParams,
-	//			"house_name":  fieldParams,
-	//			"house_type":  fieldParams,
-	//		},
-	//	},
-	//}
+	return searchQuery
+}
 
-	settings := map[string]interface{}{
-		"settings": map[string]interface{}{
-			"analysis": map[string]interface{}{
-				"filter": map[string]interface{}{
-					"edge_ngram_filter": map[string]interface{}{
-						"type":     "edge_ngram",
-						"min_gram": 1,
-						"max_gram": 20,
-					},
-				},
-				"analyzer": map[string]interface{}{
-					"edge_ngram_analyzer": map[string]interface{}{
-						"type":      "custom",
-						"tokenizer": "standard",
-						"filter":    []string{"lowercase", "edge_ngram_filter"},
-					},
-				},
+// Сортировка домов по номеру. unmapped_type - для старых индексов, если поля в них
+// не удалось дописать (см. putMissingMappings)
+func houseSort() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"house_number": map[string]interface{}{
+				"order":         "asc",
+				"missing":       "_last",
+				"unmapped_type": "integer",
 			},
 		},
-		"mappings": map[string]interface{}{
-			"properties": map[string]interface{}{
-				"street_name": map[string]interface{}{
-					"type": "text",
-					"fields": map[string]interface{}{
-						"edge": map[string]interface{}{
-							"type":            "text",
-							"analyzer":        "edge_ngram_analyzer",
-							"search_analyzer": "standard", // Для точного поиска при вводе
-						},
-						"keyword": map[string]interface{}{
-							"type": "keyword", // Для точной сортировки
-						},
-					},
-				},
-				"street_type_short_name": map[string]interface{}{
-					"type": "keyword",
-				},
-				"house_name": map[string]interface{}{
-					"type": "text",
-					"fields": map[string]interface{}{
-						"edge": map[string]interface{}{
-							"type":            "text",
-							"analyzer":        "edge_ngram_analyzer",
-							"search_analyzer": "standard",
-						},
-						"keyword": map[string]interface{}{
-							"type": "keyword",
-						},
-					},
-				},
-				"house_type_short_name": map[string]interface{}{
-					"type": "keyword",
-				},
+		{
+			"house_canonical": map[string]interface{}{
+				"order":         "asc",
+				"missing":       "_last",
+				"unmapped_type": "keyword",
 			},
 		},
 	}
+}
 
-	var buf bytes.Buffer
-	if err = json.NewEncoder(&buf).Encode(settings); err != nil {
-		return err
+type addressDocument struct {
+	*searchpb.Address
+	Suggest *completionInput `json:"suggest,omitempty"`
+
+	HouseNumber    *int   `json:"house_number,omitempty"`
+	HouseSuffix    string `json:"house_suffix,omitempty"`
+	HouseBuilding  string `json:"house_building,omitempty"`
+	HouseCanonical string `json:"house_canonical,omitempty"`
+}
+
+func newAddressDocument(address *searchpb.Address) *addressDocument {
+	doc := &addressDocument{
+		Address:        address,
+		Suggest:        newCompletionInput(address.GetStreetName(), address.GetPopularity(), nil),
+		HouseCanonical: canonicalHouse(address.GetHouseName()),
 	}
 
-	createRes, err := s.Elastic.Indices.Create(
-		"addresses",
-		s.Elastic.Indices.Create.WithBody(&buf),
-		s.Elastic.Indices.Create.WithContext(ctx),
-	)
-	if err != nil {
-		return err
+	if house, ok := normalizeHouse(address.GetHouseName()); ok {
+		if number, err := strconv.Atoi(house.number); err == nil {
+			doc.HouseNumber = &number
+		}
+
+		doc.HouseSuffix = house.letter
+		doc.HouseBuilding = house.building
 	}
-	defer createRes.Body.Close()
 
-	return nil
+	return doc
 }
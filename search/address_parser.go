@@ -0,0 +1,272 @@
+package search
+
+import (
+	"regexp"
+	"search-service/proto/searchpb"
+	"strings"
+)
+
+var streetTypes = map[string]string{
+	"ул":         "ул",
+	"улица":      "ул",
+	"пр":         "пр-кт",
+	"пр-т":       "пр-кт",
+	"пр-кт":      "пр-кт",
+	"просп":      "пр-кт",
+	"проспект":   "пр-кт",
+	"пер":        "пер",
+	"переулок":   "пер",
+	"ш":          "ш",
+	"шоссе":      "ш",
+	"б-р":        "б-р",
+	"бул":        "б-р",
+	"бульвар":    "б-р",
+	"пл":         "пл",
+	"площадь":    "пл",
+	"наб":        "наб",
+	"набережная": "наб",
+	"пр-д":       "проезд",
+	"проезд":     "проезд",
+	"туп":        "туп",
+	"тупик":      "туп",
+	"мкр":        "мкр",
+	"микрорайон": "мкр",
+	"кв-л":       "кв-л",
+	"квартал":    "кв-л",
+	"ал":         "аллея",
+	"аллея":      "аллея",
+	"тракт":      "тракт",
+}
+
+var (
+	houseMarkers    = map[string]bool{"д": true, "дом": true}
+	buildingMarkers = map[string]bool{"к": true, "корп": true, "корпус": true, "стр": true, "строение": true}
+	letterMarkers   = map[string]bool{"лит": true, "литер": true, "литера": true}
+
+	// 12, 12а, 12к1, 12/1, 12а/1, 12к1а
+	houseRe         = regexp.MustCompile(`^(\d+)([а-яёa-z])?(?:(к|корп|корпус|стр|строение|/)(\d+))?([а-яёa-z])?$`)
+	markedHouseRe   = regexp.MustCompile(`^(?:д|дом)(\d.*)$`)
+	markedBuildRe   = regexp.MustCompile(`^(?:к|корп|корпус|стр|строение)(\d+)$`)
+	singleLetterRe  = regexp.MustCompile(`^[а-яёa-z]$`)
+	tokenSeparators = strings.NewReplacer(",", " ", ";", " ", ".", ". ")
+	houseSeparators = strings.NewReplacer(" ", "", ".", "", ",", "", "-", "")
+)
+
+type houseParts struct {
+	number      string
+	letter      string
+	building    string
+	fraction    bool
+	letterFirst bool
+}
+
+func parseHouse(token string) (houseParts, bool) {
+	m := houseRe.FindStringSubmatch(token)
+	if m == nil {
+		return houseParts{}, false
+	}
+
+	letter := m[2]
+	if letter == "" {
+		letter = m[5]
+	}
+
+	return houseParts{
+		number:      m[1],
+		letter:      letter,
+		building:    m[4],
+		fraction:    m[3] == "/",
+		letterFirst: m[2] != "",
+	}, true
+}
+
+// ParseAddress разбирает строку вида "ул. Ленина, д. 12/1", "Ленина 12к1" или "12, Ленина"
+func ParseAddress(text string) *searchpb.ParsedAddress {
+	parsed := &searchpb.ParsedAddress{}
+
+	var (
+		tokens   []string
+		lowers   []string
+		house    houseParts
+		hasHouse bool
+	)
+
+	for _, token := range strings.Fields(tokenSeparators.Replace(text)) {
+		token = strings.TrimSuffix(token, ".")
+		if token == "" {
+			continue
+		}
+
+		tokens = append(tokens, token)
+		lowers = append(lowers, strings.ToLower(token))
+	}
+
+	// Ведущее число - номер дома, только если за ним запятая или тип улицы ("12, Ленина", "12 ул Ленина")
+	// и дальше нет другого числа. Иначе это часть названия: "8 Марта", "1 Мая 5"
+	leadingHouse := false
+	if len(lowers) > 1 {
+		if _, ok := parseHouse(lowers[0]); ok && (streetTypes[lowers[1]] != "" || leadingCommaHouse(text)) {
+			leadingHouse = true
+			for _, l := range lowers[1:] {
+				if _, ok := parseHouse(l); ok {
+					leadingHouse = false
+					break
+				}
+			}
+		}
+	}
+
+	var streetParts []string
+	expect := ""
+
+	for i, lower := range lowers {
+		switch {
+		case parsed.StreetType == "" && streetTypes[lower] != "" && expect == "":
+			parsed.StreetType = streetTypes[lower]
+			continue
+		case houseMarkers[lower]:
+			expect = "house"
+			continue
+		case buildingMarkers[lower] && hasHouse:
+			expect = "building"
+			continue
+		case letterMarkers[lower] && hasHouse:
+			expect = "letter"
+			continue
+		}
+
+		if m := markedHouseRe.FindStringSubmatch(lower); m != nil && !hasHouse {
+			if h, ok := parseHouse(m[1]); ok {
+				house, hasHouse = h, true
+				continue
+			}
+		}
+
+		if m := markedBuildRe.FindStringSubmatch(lower); m != nil && hasHouse && house.building == "" {
+			house.building = m[1]
+			continue
+		}
+
+		switch expect {
+		case "building":
+			expect = ""
+			if isDigits(lower) {
+				house.building = lower
+				continue
+			}
+		case "letter":
+			expect = ""
+			if singleLetterRe.MatchString(lower) {
+				house.letter = lower
+				continue
+			}
+		}
+
+		if !hasHouse {
+			if h, ok := parseHouse(lower); ok && (expect == "house" || len(streetParts) > 0 || (i == 0 && leadingHouse)) {
+				house, hasHouse = h, true
+				expect = ""
+				continue
+			}
+		} else if singleLetterRe.MatchString(lower) && house.letter == "" && i == len(lowers)-1 {
+			house.letter = lower
+			continue
+		}
+
+		expect = ""
+		streetParts = append(streetParts, tokens[i])
+	}
+
+	parsed.StreetName = strings.Join(streetParts, " ")
+
+	if hasHouse {
+		parsed.HouseNumber = house.number
+		parsed.Letter = house.letter
+		parsed.Building = house.building
+		parsed.House = house.number
+
+		if house.letterFirst || house.building == "" {
+			parsed.House += house.letter
+		}
+
+		if house.building != "" {
+			if house.fraction {
+				parsed.House += "/" + house.building
+			} else {
+				parsed.House += "к" + house.building
+			}
+
+			if !house.letterFirst {
+				parsed.House += house.letter
+			}
+		}
+	}
+
+	return parsed
+}
+
+func leadingCommaHouse(text string) bool {
+	before, _, found := strings.Cut(text, ",")
+	if !found {
+		return false
+	}
+
+	_, ok := parseHouse(strings.ToLower(strings.TrimSpace(before)))
+
+	return ok
+}
+
+// Каноническая форма не зависит от пробелов и разделителя корпуса: "12 к1", "12к1", "12/1" -> "12к1"
+func (h houseParts) canonical() string {
+	canonical := h.number + h.letter
+	if h.building != "" {
+		canonical += "к" + h.building
+	}
+
+	return canonical
+}
+
+func normalizeHouse(name string) (houseParts, bool) {
+	return parseHouse(houseSeparators.Replace(strings.ToLower(strings.TrimSpace(name))))
+}
+
+func canonicalHouse(name string) string {
+	if h, ok := normalizeHouse(name); ok {
+		return h.canonical()
+	}
+
+	return houseSeparators.Replace(strings.ToLower(strings.TrimSpace(name)))
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func withParsedAddress(search *searchpb.SearchAddress, parsed *searchpb.ParsedAddress) *searchpb.SearchAddress {
+	return &searchpb.SearchAddress{
+		StreetQuery: parsed.GetStreetName(),
+		HouseQuery:  parsed.GetHouse(),
+		StreetType:  parsed.GetStreetType(),
+		Offset:      search.GetOffset(),
+		Limit:       search.GetLimit(),
+		Near:        search.GetNear(),
+		Geo:         search.GetGeo(),
+		Admin:       search.GetAdmin(),
+		PreferAdmin: search.GetPreferAdmin(),
+		AdminFacets: search.GetAdminFacets(),
+		AutoCorrect: search.GetAutoCorrect(),
+
+		IncludeSource: search.GetIncludeSource(),
+		Fields:        search.GetFields(),
+	}
+}
@@ -0,0 +1,56 @@
+package search
+
+import (
+	"search-service/proto/searchpb"
+	"testing"
+)
+
+type parsedAddress struct {
+	StreetType  string
+	StreetName  string
+	House       string
+	HouseNumber string
+	Building    string
+	Letter      string
+}
+
+// Сгенерированные сообщения нельзя сравнивать через ==
+func newParsedAddress(p *searchpb.ParsedAddress) parsedAddress {
+	return parsedAddress{
+		StreetType:  p.GetStreetType(),
+		StreetName:  p.GetStreetName(),
+		House:       p.GetHouse(),
+		HouseNumber: p.GetHouseNumber(),
+		Building:    p.GetBuilding(),
+		Letter:      p.GetLetter(),
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		text string
+		want parsedAddress
+	}{
+		{"ул. Ленина, д. 12/1", parsedAddress{StreetType: "ул", StreetName: "Ленина", House: "12/1", HouseNumber: "12", Building: "1"}},
+		{"Ленина 12к1", parsedAddress{StreetName: "Ленина", House: "12к1", HouseNumber: "12", Building: "1"}},
+		{"Ленина 12а", parsedAddress{StreetName: "Ленина", House: "12а", HouseNumber: "12", Letter: "а"}},
+		{"Ленина 12 корп 2", parsedAddress{StreetName: "Ленина", House: "12к2", HouseNumber: "12", Building: "2"}},
+		{"12, Ленина", parsedAddress{StreetName: "Ленина", House: "12", HouseNumber: "12"}},
+		{"12 ул Ленина", parsedAddress{StreetType: "ул", StreetName: "Ленина", House: "12", HouseNumber: "12"}},
+		// Улицы, названные датами: ведущее число - часть названия
+		{"8 Марта", parsedAddress{StreetName: "8 Марта"}},
+		{"1 Мая", parsedAddress{StreetName: "1 Мая"}},
+		{"8 Марта 12", parsedAddress{StreetName: "8 Марта", House: "12", HouseNumber: "12"}},
+		{"ул. 8 Марта, д. 5", parsedAddress{StreetType: "ул", StreetName: "8 Марта", House: "5", HouseNumber: "5"}},
+		{"1 Мая, 5", parsedAddress{StreetName: "1 Мая", House: "5", HouseNumber: "5"}},
+		{"Ленина", parsedAddress{StreetName: "Ленина"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := newParsedAddress(ParseAddress(tt.text)); got != tt.want {
+				t.Errorf("ParseAddress(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
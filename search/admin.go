@@ -0,0 +1,88 @@
+package search
+
+import (
+	"search-service/proto/searchpb"
+)
+
+const adminGroupsLimit = 20
+
+var adminKeywordMapping = map[string]interface{}{
+	"type": "keyword",
+}
+
+type AdminGroup struct {
+	Region   string
+	District string
+	Locality string
+	Count    int32
+}
+
+type adminLevel struct {
+	field  string
+	values []string
+	boost  float64
+}
+
+// Более мелкий уровень поднимает сильнее: совпадение населённого пункта важнее совпадения региона
+func adminLevels(area *searchpb.AdminArea) []adminLevel {
+	return []adminLevel{
+		{"region", area.GetRegions(), 1.5},
+		{"district", area.GetDistricts(), 2},
+		{"locality", area.GetLocalities(), 3},
+	}
+}
+
+// prefix - путь до полей адреса: "" для addresses/streets, "address." для nodes/hardware
+func buildAdminFilter(prefix string, area *searchpb.AdminArea) []map[string]interface{} {
+	var filters []map[string]interface{}
+
+	for _, level := range adminLevels(area) {
+		if len(level.values) == 0 {
+			continue
+		}
+
+		filters = append(filters, map[string]interface{}{
+			"terms": map[string]interface{}{
+				prefix + level.field: level.values,
+			},
+		})
+	}
+
+	return filters
+}
+
+func buildAdminBoost(prefix string, area *searchpb.AdminArea) []map[string]interface{} {
+	var should []map[string]interface{}
+
+	for _, level := range adminLevels(area) {
+		if len(level.values) == 0 {
+			continue
+		}
+
+		should = append(should, map[string]interface{}{
+			"terms": map[string]interface{}{
+				prefix + level.field: level.values,
+				"boost":              level.boost,
+			},
+		})
+	}
+
+	return should
+}
+
+func buildAdminAggregation(prefix string) map[string]interface{} {
+	var terms []map[string]interface{}
+	for _, level := range adminLevels(nil) {
+		terms = append(terms, map[string]interface{}{
+			"field":   prefix + level.field,
+			"missing": "",
+		})
+	}
+
+	return map[string]interface{}{
+		"multi_terms": map[string]interface{}{
+			"terms": terms,
+			"size":  adminGroupsLimit,
+		},
+	}
+}
@@ -0,0 +1,267 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"search-service/proto/searchpb"
+	"sort"
+	"time"
+)
+
+const (
+	defaultSearchAllLimit = 10
+	// Запас на сеть и разбор ответа: ES должен успеть вернуть частичный результат до отмены контекста
+	searchAllTimeoutMargin = 100 * time.Millisecond
+)
+
+type GlobalSearch interface {
+	SearchAll(ctx context.Context, req *searchpb.SearchAllRequest) (*AllResult, error)
+}
+
+type DefaultGlobalSearch struct {
+	Elastic *elasticsearch.Client
+	Cache   *SearchCache
+}
+
+type EntityResult struct {
+	Entity searchpb.Entity
+	Limit  int32
+	Result *SearchResult
+	Err    error
+	// ES не уложился в timeout и вернул только часть хитов
+	TimedOut bool
+}
+
+type BlendedHit struct {
+	Entity searchpb.Entity
+	ID     int32
+	Score  float64
+}
+
+type AllResult struct {
+	Groups  []*EntityResult
+	Blended []BlendedHit
+}
+
+func (r *AllResult) TimedOut() bool {
+	for _, group := range r.Groups {
+		if group.TimedOut {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *AllResult) partial() bool {
+	for _, group := range r.Groups {
+		if group.Err != nil {
+			return true
+		}
+	}
+
+	return r.TimedOut()
+}
+
+func (s *DefaultGlobalSearch) SearchAll(ctx context.Context, req *searchpb.SearchAllRequest) (*AllResult, error) {
+	return cachedSearch(s.Cache, "all", []string{"nodes", "hardware", "addresses"}, req, req.GetBypassCache(), func() (*AllResult, error) {
+		return s.searchAll(ctx, req)
+	})
+}
+
+func (s *DefaultGlobalSearch) searchAll(ctx context.Context, req *searchpb.SearchAllRequest) (*AllResult, error) {
+	nodeLimit := searchAllLimit(req.GetNodeLimit(), req.GetLimit())
+	hardwareLimit := searchAllLimit(req.GetHardwareLimit(), req.GetLimit())
+	addressLimit := searchAllLimit(req.GetAddressLimit(), req.GetLimit())
+
+	// Ошибка разбора языка запросов относится к своей группе, остальные группы ищем как обычно
+	nodeQuery, nodeErr := buildNodeSearchQuery(&searchpb.Search{Query: req.GetQuery(), Limit: nodeLimit}, req.GetNodeFilter())
+	hardwareQuery, hardwareErr := buildHardwareSearchQuery(&searchpb.Search{Query: req.GetQuery(), Limit: hardwareLimit}, req.GetHardwareFilter())
+
+	queries := []struct {
+		entity searchpb.Entity
+		index  string
+		limit  int32
+		body   map[string]interface{}
+		err    error
+	}{
+		{searchpb.Entity_ENTITY_NODE, "nodes", nodeLimit, nodeQuery, nodeErr},
+		{searchpb.Entity_ENTITY_HARDWARE, "hardware", hardwareLimit, hardwareQuery, hardwareErr},
+		{searchpb.Entity_ENTITY_ADDRESS, "addresses", addressLimit, buildAddressSearchQuery(withParsedAddress(&searchpb.SearchAddress{Limit: addressLimit}, ParseAddress(req.GetQuery()))), nil},
+	}
+
+	// Общий дедлайн передаём в каждый поиск, чтобы ES вернул частичный результат, а не оборвал весь _msearch
+	var timeout string
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, ctx.Err()
+		}
+
+		margin := searchAllTimeoutMargin
+		if remaining < 2*margin {
+			margin = remaining / 2
+		}
+
+		timeout = fmt.Sprintf("%dms", (remaining - margin).Milliseconds())
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	sent := 0
+
+	for _, q := range queries {
+		if q.err != nil {
+			continue
+		}
+
+		sent++
+
+		if timeout != "" {
+			q.body["timeout"] = timeout
+		}
+
+		q.body["track_total_hits"] = true
+		// При явной сортировке ES не считает _score и max_score, а без них группу не смешать
+		q.body["track_scores"] = true
+
+		if err := enc.Encode(map[string]interface{}{"index": q.index}); err != nil {
+			return nil, err
+		}
+
+		if err := enc.Encode(q.body); err != nil {
+			return nil, err
+		}
+	}
+
+	// Адресная группа собирается всегда, так что пустым _msearch не бывает
+	responses, err := s.msearch(ctx, &buf, sent)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AllResult{}
+	failed := 0
+
+	for _, q := range queries {
+		group := &EntityResult{Entity: q.entity, Limit: q.limit, Err: q.err}
+
+		if q.err == nil {
+			resp := responses[0]
+			responses = responses[1:]
+
+			if resp.Error != nil {
+				group.Err = fmt.Errorf("search %s failed: status=%d %s", q.index, resp.Status, resp.Error)
+			} else {
+				group.Result, group.Err = resp.result(false)
+				group.TimedOut = resp.TimedOut
+			}
+		}
+
+		if group.Err != nil {
+			failed++
+		}
+
+		result.Groups = append(result.Groups, group)
+	}
+
+	if failed == len(queries) {
+		return nil, result.Groups[0].Err
+	}
+
+	if n := req.GetBlendedLimit(); n > 0 {
+		result.Blended = blendResults(result.Groups, int(n))
+	}
+
+	return result, nil
+}
+
+type msearchResponse struct {
+	searchResponse
+	Error  json.RawMessage `json:"error"`
+	Status int             `json:"status"`
+}
+
+func (s *DefaultGlobalSearch) msearch(ctx context.Context, body *bytes.Buffer, expected int) ([]msearchResponse, error) {
+	res, err := s.Elastic.Msearch(
+		body,
+		s.Elastic.Msearch.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("msearch failed: %s", res.String())
+	}
+
+	var r struct {
+		Responses []msearchResponse `json:"responses"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	if len(r.Responses) != expected {
+		return nil, fmt.Errorf("msearch returned %d responses, expected %d", len(r.Responses), expected)
+	}
+
+	return r.Responses, nil
+}
+
+// Лимит группы, если не задан - общий лимит запроса, затем лимит по умолчанию
+func searchAllLimit(limit, common int32) int32 {
+	if limit > 0 {
+		return limit
+	}
+
+	if common > 0 {
+		return common
+	}
+
+	return defaultSearchAllLimit
+}
+
+// Оценки разных индексов несравнимы, поэтому нормализуем каждую группу на её максимум.
+// Максимум берём по полученным хитам: max_score при сортировке не по _score приходит null
+func blendResults(groups []*EntityResult, limit int) []BlendedHit {
+	var hits []BlendedHit
+
+	for _, group := range groups {
+		if group.Err != nil {
+			continue
+		}
+
+		maxScore := group.Result.MaxScore
+		for _, score := range group.Result.Scores {
+			maxScore = max(maxScore, score)
+		}
+
+		if maxScore <= 0 {
+			continue
+		}
+
+		for i, id := range group.Result.IDs {
+			hits = append(hits, BlendedHit{
+				Entity: group.Entity,
+				ID:     id,
+				Score:  group.Result.Scores[i] / maxScore,
+			})
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	return hits
+}
@@ -0,0 +1,391 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	analyticsIndex         = "search_analytics"
+	analyticsBuffer        = 4096
+	analyticsFlushInterval = 5 * time.Second
+)
+
+var latencyPercents = []float64{50, 90, 95, 99}
+
+type SearchEvent struct {
+	Timestamp  int64       `json:"timestamp"`
+	Entity     string      `json:"entity"`
+	Query      string      `json:"query"`
+	Filters    interface{} `json:"filters,omitempty"`
+	Total      int32       `json:"total"`
+	ZeroResult bool        `json:"zero_result"`
+	LatencyMs  int64       `json:"latency_ms"`
+	Caller     string      `json:"caller,omitempty"`
+}
+
+type QueryCount struct {
+	Query string
+	Count int64
+}
+
+type LatencyPercentile struct {
+	Percent float64
+	Millis  float64
+}
+
+type SearchStats struct {
+	Searches             int64
+	ZeroResultSearches   int64
+	TopQueries           []QueryCount
+	TopZeroResultQueries []QueryCount
+	Latency              []LatencyPercentile
+}
+
+type SearchAnalytics interface {
+	Record(event *SearchEvent)
+	SearchStats(ctx context.Context, entity string, from, to time.Time, size int) (*SearchStats, error)
+}
+
+// ErrAnalyticsDisabled - аналитика не запустилась, статистики нет
+var ErrAnalyticsDisabled = errors.New("search analytics is disabled")
+
+// NopSearchAnalytics подставляется, если индекс аналитики недоступен: поиск работает и без неё
+type NopSearchAnalytics struct{}
+
+func (NopSearchAnalytics) Record(*SearchEvent) {}
+
+func (NopSearchAnalytics) SearchStats(context.Context, string, time.Time, time.Time, int) (*SearchStats, error) {
+	return nil, ErrAnalyticsDisabled
+}
+
+// DefaultSearchAnalytics пишет события в фоне: Record не ждёт Elasticsearch,
+// а при переполнении буфера событие отбрасывается
+type DefaultSearchAnalytics struct {
+	Elastic *elasticsearch.Client
+
+	mu      sync.RWMutex
+	closed  bool
+	events  chan *SearchEvent
+	indexer esutil.BulkIndexer
+	dropped atomic.Int64
+	done    chan struct{}
+}
+
+func NewSearchAnalytics(es *elasticsearch.Client) (*DefaultSearchAnalytics, error) {
+	a := &DefaultSearchAnalytics{
+		Elastic: es,
+		events:  make(chan *SearchEvent, analyticsBuffer),
+		done:    make(chan struct{}),
+	}
+
+	if err := a.EnsureIndexAnalytics(context.Background()); err != nil {
+		return nil, err
+	}
+
+	indexer, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Client:        es,
+		Index:         analyticsIndex,
+		NumWorkers:    1,
+		FlushInterval: analyticsFlushInterval,
+		OnError: func(_ context.Context, err error) {
+			log.Printf("SearchAnalytics: bulk error: %v\n", err)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.indexer = indexer
+
+	go a.run()
+
+	return a, nil
+}
+
+// NormalizeQuery приводит запрос к виду, по которому его можно группировать
+func NormalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+func (a *DefaultSearchAnalytics) Record(event *SearchEvent) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return
+	}
+
+	select {
+	case a.events <- event:
+	default:
+		if a.dropped.Add(1)%1000 == 1 {
+			log.Printf("SearchAnalytics: buffer is full, dropped %d events\n", a.dropped.Load())
+		}
+	}
+}
+
+func (a *DefaultSearchAnalytics) run() {
+	defer close(a.done)
+
+	for event := range a.events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("SearchAnalytics: failed to marshal event: %v\n", err)
+			continue
+		}
+
+		err = a.indexer.Add(context.Background(), esutil.BulkIndexerItem{
+			Action: "index",
+			Body:   bytes.NewReader(data),
+			OnFailure: func(_ context.Context, _ esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+				if err == nil {
+					err = fmt.Errorf("%s: %s", res.Error.Type, res.Error.Reason)
+				}
+				log.Printf("SearchAnalytics: failed to index event: %v\n", err)
+			},
+		})
+		if err != nil {
+			log.Printf("SearchAnalytics: failed to add event: %v\n", err)
+		}
+	}
+}
+
+// Close дописывает накопленные события, последующие Record игнорируются
+func (a *DefaultSearchAnalytics) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.events)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return a.indexer.Close(ctx)
+}
+
+// SearchStats считает статистику за окно [from, to). Пустая entity - все сущности.
+// Поиски без текста (только фильтры) в топ запросов не попадают
+func (a *DefaultSearchAnalytics) SearchStats(ctx context.Context, entity string, from, to time.Time, size int) (*SearchStats, error) {
+	filters := []map[string]interface{}{
+		{"range": map[string]interface{}{
+			"timestamp": map[string]interface{}{
+				"gte": from.UnixMilli(),
+				"lt":  to.UnixMilli(),
+			},
+		}},
+	}
+
+	if entity != "" {
+		filters = append(filters, map[string]interface{}{
+			"term": map[string]interface{}{"entity": entity},
+		})
+	}
+
+	topQueries := map[string]interface{}{
+		"terms": map[string]interface{}{
+			"field": "query",
+			"size":  size,
+		},
+	}
+
+	searchQuery := map[string]interface{}{
+		"size":             0,
+		"track_total_hits": true,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": filters,
+			},
+		},
+		"aggs": map[string]interface{}{
+			"zero_result": map[string]interface{}{
+				"filter": map[string]interface{}{
+					"term": map[string]interface{}{"zero_result": true},
+				},
+			},
+			"with_query": map[string]interface{}{
+				"filter": map[string]interface{}{
+					"bool": map[string]interface{}{
+						"must_not": map[string]interface{}{
+							"term": map[string]interface{}{"query": ""},
+						},
+					},
+				},
+				"aggs": map[string]interface{}{
+					"top": topQueries,
+					"zero_result": map[string]interface{}{
+						"filter": map[string]interface{}{
+							"term": map[string]interface{}{"zero_result": true},
+						},
+						"aggs": map[string]interface{}{
+							"top": topQueries,
+						},
+					},
+				},
+			},
+			"latency": map[string]interface{}{
+				"percentiles": map[string]interface{}{
+					"field":    "latency_ms",
+					"percents": latencyPercents,
+					"keyed":    false,
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(searchQuery); err != nil {
+		return nil, err
+	}
+
+	res, err := a.Elastic.Search(
+		a.Elastic.Search.WithContext(ctx),
+		a.Elastic.Search.WithIndex(analyticsIndex),
+		a.Elastic.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("search stats failed: %s", res.String())
+	}
+
+	type buckets struct {
+		Buckets []struct {
+			Key      string `json:"key"`
+			DocCount int64  `json:"doc_count"`
+		} `json:"buckets"`
+	}
+
+	var r struct {
+		Hits struct {
+			Total struct {
+				Value int64 `json:"value"`
+			} `json:"total"`
+		} `json:"hits"`
+		Aggregations struct {
+			ZeroResult struct {
+				DocCount int64 `json:"doc_count"`
+			} `json:"zero_result"`
+			WithQuery struct {
+				Top        buckets `json:"top"`
+				ZeroResult struct {
+					Top buckets `json:"top"`
+				} `json:"zero_result"`
+			} `json:"with_query"`
+			Latency struct {
+				Values []struct {
+					Key   float64  `json:"key"`
+					Value *float64 `json:"value"`
+				} `json:"values"`
+			} `json:"latency"`
+		} `json:"aggregations"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	queryCounts := func(b buckets) []QueryCount {
+		counts := make([]QueryCount, 0, len(b.Buckets))
+		for _, bucket := range b.Buckets {
+			counts = append(counts, QueryCount{Query: bucket.Key, Count: bucket.DocCount})
+		}
+		return counts
+	}
+
+	stats := &SearchStats{
+		Searches:             r.Hits.Total.Value,
+		ZeroResultSearches:   r.Aggregations.ZeroResult.DocCount,
+		TopQueries:           queryCounts(r.Aggregations.WithQuery.Top),
+		TopZeroResultQueries: queryCounts(r.Aggregations.WithQuery.ZeroResult.Top),
+	}
+
+	// Без событий в окне перцентили приходят null
+	for _, value := range r.Aggregations.Latency.Values {
+		if value.Value == nil {
+			continue
+		}
+
+		stats.Latency = append(stats.Latency, LatencyPercentile{Percent: value.Key, Millis: *value.Value})
+	}
+
+	return stats, nil
+}
+
+func (a *DefaultSearchAnalytics) EnsureIndexAnalytics(ctx context.Context) error {
+	res, err := a.Elastic.Indices.Exists([]string{analyticsIndex}, a.Elastic.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 200 {
+		return nil
+	}
+
+	settings := map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"timestamp": updatedAtMapping,
+				"entity": map[string]interface{}{
+					"type": "keyword",
+				},
+				"query": map[string]interface{}{
+					"type":         "keyword",
+					"ignore_above": 512,
+				},
+				// Набор фильтров у сущностей разный, flattened не раздувает маппинг
+				"filters": map[string]interface{}{
+					"type": "flattened",
+				},
+				"total": map[string]interface{}{
+					"type": "integer",
+				},
+				"zero_result": map[string]interface{}{
+					"type": "boolean",
+				},
+				"latency_ms": map[string]interface{}{
+					"type": "long",
+				},
+				"caller": map[string]interface{}{
+					"type": "keyword",
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err = json.NewEncoder(&buf).Encode(settings); err != nil {
+		return err
+	}
+
+	createRes, err := a.Elastic.Indices.Create(
+		analyticsIndex,
+		a.Elastic.Indices.Create.WithBody(&buf),
+		a.Elastic.Indices.Create.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer createRes.Body.Close()
+
+	return nil
+}
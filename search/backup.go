@@ -0,0 +1,202 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"net/http"
+)
+
+// Только эти настройки переносятся при восстановлении; служебные (uuid, creation_date, version...)
+// ES выставит сам
+var backupSettings = []string{"number_of_shards", "number_of_replicas", "analysis", "max_ngram_diff", "max_result_window"}
+
+type IndexDefinition struct {
+	Settings map[string]interface{} `json:"settings"`
+	Mappings json.RawMessage        `json:"mappings"`
+}
+
+// ID - строка: у служебных индексов (saved_searches, search_analytics) _id не число
+type RawDocument struct {
+	ID     string          `json:"_id"`
+	Source json.RawMessage `json:"_source"`
+}
+
+func GetIndexDefinition(ctx context.Context, es *elasticsearch.Client, index string) (*IndexDefinition, error) {
+	res, err := es.Indices.Get(
+		[]string{index},
+		es.Indices.Get.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("get index failed: %s", res.String())
+	}
+
+	var r map[string]struct {
+		Mappings json.RawMessage `json:"mappings"`
+		Settings struct {
+			Index map[string]interface{} `json:"index"`
+		} `json:"settings"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	if len(r) != 1 {
+		return nil, fmt.Errorf("expected one index for %s, got %d", index, len(r))
+	}
+
+	def := &IndexDefinition{Settings: map[string]interface{}{}}
+
+	for _, idx := range r {
+		def.Mappings = idx.Mappings
+
+		for _, key := range backupSettings {
+			if value, ok := idx.Settings.Index[key]; ok {
+				def.Settings[key] = value
+			}
+		}
+	}
+
+	return def, nil
+}
+
+// ScanIndex отдаёт все документы индекса вместе с _source пачками
+func ScanIndex(ctx context.Context, es *elasticsearch.Client, index string, batchSize int32, send func([]RawDocument) error) error {
+	searchQuery := map[string]interface{}{
+		"query": map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		},
+		"sort": []map[string]interface{}{
+			{"_shard_doc": "asc"},
+		},
+	}
+
+	return scanPIT(ctx, es, index, searchQuery, batchSize, func(r *searchResponse) error {
+		docs := make([]RawDocument, 0, len(r.Hits.Hits))
+		for _, hit := range r.Hits.Hits {
+			docs = append(docs, RawDocument{ID: hit.ID, Source: hit.Source})
+		}
+
+		return send(docs)
+	})
+}
+
+func IndexExists(ctx context.Context, es *elasticsearch.Client, index string) (bool, error) {
+	res, err := es.Indices.Exists([]string{index}, es.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	return res.StatusCode == 200, nil
+}
+
+// IsConcreteIndex - name это сам индекс, а не alias
+func IsConcreteIndex(ctx context.Context, es *elasticsearch.Client, name string) (bool, error) {
+	res, err := es.Indices.Get(
+		[]string{name},
+		es.Indices.Get.WithContext(ctx),
+	)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	if res.IsError() {
+		return false, fmt.Errorf("get index failed: %s", res.String())
+	}
+
+	var r map[string]json.RawMessage
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return false, err
+	}
+
+	_, ok := r[name]
+
+	return ok, nil
+}
+
+func CreateIndex(ctx context.Context, es *elasticsearch.Client, index string, def *IndexDefinition) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(def); err != nil {
+		return err
+	}
+
+	res, err := es.Indices.Create(
+		index,
+		es.Indices.Create.WithBody(&buf),
+		es.Indices.Create.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("create index failed: %s", res.String())
+	}
+
+	return nil
+}
+
+// PointAlias атомарно переносит alias со всех индексов на index
+func PointAlias(ctx context.Context, es *elasticsearch.Client, alias, index string) error {
+	actions := map[string]interface{}{
+		"actions": []map[string]interface{}{
+			{"remove": map[string]interface{}{"index": "*", "alias": alias, "must_exist": false}},
+			{"add": map[string]interface{}{"index": index, "alias": alias}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(actions); err != nil {
+		return err
+	}
+
+	res, err := es.Indices.UpdateAliases(
+		&buf,
+		es.Indices.UpdateAliases.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("update aliases failed: %s", res.String())
+	}
+
+	return nil
+}
+
+// NewRawIndexer восстанавливает документы с версией из updated_at, как при обычной индексации,
+// чтобы запоздавшие сообщения из Kafka не перезаписали восстановленные данные
+func NewRawIndexer(es *elasticsearch.Client, index string) (*StreamIndexer[RawDocument], error) {
+	return newStreamIndexer(es, nil, index,
+		func(doc RawDocument) string { return doc.ID },
+		func(doc RawDocument) interface{} { return doc.Source },
+		func(doc RawDocument) int64 {
+			var source struct {
+				UpdatedAt int64 `json:"updated_at"`
+			}
+
+			if err := json.Unmarshal(doc.Source, &source); err != nil {
+				return 0
+			}
+
+			return source.UpdatedAt
+		},
+	)
+}
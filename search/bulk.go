@@ -0,0 +1,160 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+	"net/http"
+	"search-service/metrics"
+	"sync"
+)
+
+const (
+	bulkWorkers    = 2
+	bulkFlushBytes = 2 << 20
+)
+
+type BulkSummary struct {
+	Indexed   int32
+	Skipped   int32
+	Failed    int32
+	FailedIDs []string
+}
+
+// StreamIndexer индексирует документы по мере поступления. Add блокируется, пока воркеры заняты,
+// поэтому в памяти держится не больше bulkWorkers*bulkFlushBytes данных
+type StreamIndexer[T any] struct {
+	elastic *elasticsearch.Client
+	cache   *SearchCache
+	index   string
+	indexer esutil.BulkIndexer
+	idOf    func(T) string
+	docOf   func(T) interface{}
+	// versionOf может быть nil - тогда версионирование внутреннее
+	versionOf func(T) int64
+	// Необязательные хуки: onIndexed получает каждый записанный документ (устаревшие по версии
+	// не записываются), onClose вызывается после refresh
+	onIndexed func(T)
+	onClose   func(ctx context.Context) error
+
+	mu      sync.Mutex
+	summary BulkSummary
+}
+
+func newStreamIndexer[T any](es *elasticsearch.Client, cache *SearchCache, index string, idOf func(T) string, docOf func(T) interface{}, versionOf func(T) int64) (*StreamIndexer[T], error) {
+	indexer, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Client:     es,
+		Index:      index,
+		NumWorkers: bulkWorkers,
+		FlushBytes: bulkFlushBytes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamIndexer[T]{
+		elastic:   es,
+		cache:     cache,
+		index:     index,
+		indexer:   indexer,
+		idOf:      idOf,
+		docOf:     docOf,
+		versionOf: versionOf,
+	}, nil
+}
+
+func (i *StreamIndexer[T]) Add(ctx context.Context, item T) error {
+	id := i.idOf(item)
+
+	data, err := json.Marshal(i.docOf(item))
+	if err != nil {
+		i.fail(id)
+		return nil
+	}
+
+	bulkItem := esutil.BulkIndexerItem{
+		Action:     "index",
+		DocumentID: id,
+		Body:       bytes.NewReader(data),
+		OnSuccess: func(_ context.Context, _ esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
+			observeBulkItem(i.index, res.Status)
+
+			if i.onIndexed != nil {
+				i.onIndexed(item)
+			}
+
+			i.mu.Lock()
+			i.summary.Indexed++
+			i.mu.Unlock()
+		},
+		OnFailure: func(_ context.Context, _ esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+			if err == nil && res.Status == http.StatusConflict {
+				observeBulkItem(i.index, res.Status)
+
+				i.mu.Lock()
+				i.summary.Skipped++
+				i.mu.Unlock()
+				return
+			}
+
+			i.fail(id)
+		},
+	}
+
+	if i.versionOf != nil {
+		if version := i.versionOf(item); version > 0 {
+			bulkItem.Version = &version
+			bulkItem.VersionType = versionType
+		}
+	}
+
+	return i.indexer.Add(ctx, bulkItem)
+}
+
+func (i *StreamIndexer[T]) fail(id string) {
+	metrics.BulkDocuments.WithLabelValues(i.index, "failed").Inc()
+
+	i.mu.Lock()
+	i.summary.Failed++
+	i.summary.FailedIDs = append(i.summary.FailedIDs, id)
+	i.mu.Unlock()
+}
+
+// Close дожидается отправки всех документов и один раз обновляет индекс
+func (i *StreamIndexer[T]) Close(ctx context.Context) (*BulkSummary, error) {
+	if err := i.indexer.Close(ctx); err != nil {
+		return nil, err
+	}
+
+	// Документы уже записаны, даже если обновить индекс не удастся
+	defer i.cache.Invalidate(i.index)
+
+	res, err := i.elastic.Indices.Refresh(
+		i.elastic.Indices.Refresh.WithIndex(i.index),
+		i.elastic.Indices.Refresh.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("refresh failed: %s", res.String())
+	}
+
+	if i.onClose != nil {
+		if err = i.onClose(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	summary := i.summary
+
+	return &summary, nil
+}
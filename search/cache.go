@@ -0,0 +1,331 @@
+package search
+
+import (
+	"container/list"
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheSize = 10000
+	defaultCacheTTL  = 30 * time.Second
+)
+
+var (
+	cacheHitsDesc          = cacheDesc("hits_total", "Search cache hits.")
+	cacheMissesDesc        = cacheDesc("misses_total", "Search cache misses.")
+	cacheBypassedDesc      = cacheDesc("bypassed_total", "Searches that asked to bypass the cache.")
+	cacheEvictionsDesc     = cacheDesc("evictions_total", "Entries evicted to stay within the size limit.")
+	cacheInvalidationsDesc = cacheDesc("invalidations_total", "Entries dropped as expired or invalidated by writes.")
+	cacheEntriesDesc       = cacheDesc("entries", "Entries currently in the search cache.")
+)
+
+type CacheStats struct {
+	Hits          int64
+	Misses        int64
+	Bypassed      int64
+	Evictions     int64
+	Invalidations int64
+	Size          int
+}
+
+// SearchCache - LRU с TTL для результатов поиска. Записи помнят поколения индексов,
+// из которых они собраны; Invalidate(index) увеличивает поколение, и такие записи больше не отдаются.
+// nil-кэш допустим: поиск идёт мимо него
+type SearchCache struct {
+	size int
+	ttl  time.Duration
+
+	mu          sync.Mutex
+	entries     *list.List
+	byKey       map[string]*list.Element
+	generations map[string]uint64
+	stats       map[string]*CacheStats
+}
+
+type cacheEntry struct {
+	key         string
+	name        string
+	value       interface{}
+	expires     time.Time
+	indices     []string
+	generations []uint64
+}
+
+func NewSearchCache(size int, ttl time.Duration) *SearchCache {
+	return &SearchCache{
+		size:        size,
+		ttl:         ttl,
+		entries:     list.New(),
+		byKey:       make(map[string]*list.Element),
+		generations: make(map[string]uint64),
+		stats:       make(map[string]*CacheStats),
+	}
+}
+
+// NewSearchCacheFromEnv читает SEARCH_CACHE_SIZE и SEARCH_CACHE_TTL; размер 0 выключает кэш
+func NewSearchCacheFromEnv() *SearchCache {
+	size := defaultCacheSize
+	if value, err := strconv.Atoi(os.Getenv("SEARCH_CACHE_SIZE")); err == nil {
+		size = value
+	}
+
+	ttl := defaultCacheTTL
+	if value, err := time.ParseDuration(os.Getenv("SEARCH_CACHE_TTL")); err == nil {
+		ttl = value
+	}
+
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+
+	return NewSearchCache(size, ttl)
+}
+
+// Invalidate вызывается после любой записи в индекс
+func (c *SearchCache) Invalidate(indices ...string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, index := range indices {
+		c.generations[index]++
+	}
+}
+
+// Stats возвращает счётчики по каждому виду поиска
+func (c *SearchCache) Stats() map[string]CacheStats {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make(map[string]CacheStats, len(c.stats))
+	for name, s := range c.stats {
+		stats[name] = *s
+	}
+
+	return stats
+}
+
+func (c *SearchCache) get(name, key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.statsOf(name)
+
+	element, ok := c.byKey[key]
+	if !ok {
+		stats.Misses++
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+
+	if time.Now().After(entry.expires) || !c.isCurrent(entry) {
+		c.remove(element)
+		stats.Invalidations++
+		stats.Misses++
+		return nil, false
+	}
+
+	c.entries.MoveToFront(element)
+	stats.Hits++
+
+	return entry.value, true
+}
+
+func (c *SearchCache) put(name, key string, value interface{}, indices []string, generations []uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{
+		key:         key,
+		name:        name,
+		value:       value,
+		expires:     time.Now().Add(c.ttl),
+		indices:     indices,
+		generations: generations,
+	}
+
+	// Индекс успели изменить, пока шёл поиск - результат может быть уже устаревшим
+	if !c.isCurrent(entry) {
+		return
+	}
+
+	if element, ok := c.byKey[key]; ok {
+		c.remove(element)
+	}
+
+	c.byKey[key] = c.entries.PushFront(entry)
+	c.statsOf(name).Size++
+
+	for c.entries.Len() > c.size {
+		oldest := c.entries.Back()
+		c.statsOf(oldest.Value.(*cacheEntry).name).Evictions++
+		c.remove(oldest)
+	}
+}
+
+func (c *SearchCache) snapshot(indices []string) []uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	generations := make([]uint64, len(indices))
+	for i, index := range indices {
+		generations[i] = c.generations[index]
+	}
+
+	return generations
+}
+
+func (c *SearchCache) bypass(name string) {
+	c.mu.Lock()
+	c.statsOf(name).Bypassed++
+	c.mu.Unlock()
+}
+
+func (c *SearchCache) isCurrent(entry *cacheEntry) bool {
+	for i, index := range entry.indices {
+		if c.generations[index] != entry.generations[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *SearchCache) remove(element *list.Element) {
+	entry := c.entries.Remove(element).(*cacheEntry)
+	delete(c.byKey, entry.key)
+	c.statsOf(entry.name).Size--
+}
+
+func (c *SearchCache) statsOf(name string) *CacheStats {
+	stats, ok := c.stats[name]
+	if !ok {
+		stats = &CacheStats{}
+		c.stats[name] = stats
+	}
+
+	return stats
+}
+
+type partialResult interface {
+	partial() bool
+}
+
+// cachedSearch отдаёт результат из кэша или выполняет run. Результат из кэша общий
+// для всех запросов, изменять его нельзя
+func cachedSearch[T any](c *SearchCache, name string, indices []string, request interface{}, bypass bool, run func() (T, error)) (T, error) {
+	if c == nil {
+		return run()
+	}
+
+	if bypass {
+		c.bypass(name)
+		return run()
+	}
+
+	key, err := cacheKey(name, request)
+	if err != nil {
+		return run()
+	}
+
+	if value, ok := c.get(name, key); ok {
+		return value.(T), nil
+	}
+
+	generations := c.snapshot(indices)
+
+	result, err := run()
+	if err != nil {
+		return result, err
+	}
+
+	// Частичный результат (часть индексов не ответила) не кэшируем, иначе сбой продержится весь TTL
+	if p, ok := any(result).(partialResult); ok && p.partial() {
+		return result, nil
+	}
+
+	c.put(name, key, result, indices, generations)
+
+	return result, nil
+}
+
+// cacheKey нормализует запрос: пробелы в текстовых запросах схлопываются,
+// флаг обхода кэша в ключ не входит. Ключи map сериализуются отсортированными
+func cacheKey(name string, request interface{}) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	var normalized interface{}
+	if err = json.Unmarshal(data, &normalized); err != nil {
+		return "", err
+	}
+
+	if fields, ok := normalized.(map[string]interface{}); ok {
+		normalizeCacheFields(fields)
+	}
+
+	if data, err = json.Marshal(normalized); err != nil {
+		return "", err
+	}
+
+	return name + "\x00" + string(data), nil
+}
+
+func normalizeCacheFields(fields map[string]interface{}) {
+	for key, value := range fields {
+		if strings.EqualFold(key, "bypass_cache") || strings.EqualFold(key, "BypassCache") {
+			delete(fields, key)
+			continue
+		}
+
+		switch v := value.(type) {
+		case string:
+			if strings.HasSuffix(strings.ToLower(key), "query") {
+				fields[key] = strings.Join(strings.Fields(v), " ")
+			}
+		case map[string]interface{}:
+			normalizeCacheFields(v)
+		}
+	}
+}
+
+func cacheDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc("search_service_search_cache_"+name, help, []string{"search"}, nil)
+}
+
+// SearchCache сам отдаёт свою статистику в Prometheus
+func (c *SearchCache) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheHitsDesc
+	ch <- cacheMissesDesc
+	ch <- cacheBypassedDesc
+	ch <- cacheEvictionsDesc
+	ch <- cacheInvalidationsDesc
+	ch <- cacheEntriesDesc
+}
+
+func (c *SearchCache) Collect(ch chan<- prometheus.Metric) {
+	for name, stats := range c.Stats() {
+		ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(stats.Hits), name)
+		ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(stats.Misses), name)
+		ch <- prometheus.MustNewConstMetric(cacheBypassedDesc, prometheus.CounterValue, float64(stats.Bypassed), name)
+		ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue, float64(stats.Evictions), name)
+		ch <- prometheus.MustNewConstMetric(cacheInvalidationsDesc, prometheus.CounterValue, float64(stats.Invalidations), name)
+		ch <- prometheus.MustNewConstMetric(cacheEntriesDesc, prometheus.GaugeValue, float64(stats.Size), name)
+	}
+}
@@ -0,0 +1,279 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"log"
+	"search-service/proto/searchpb"
+	"time"
+)
+
+// Индексы, в документах которых хранится копия адреса
+var cascadeIndices = []string{"nodes", "hardware"}
+
+const (
+	cascadeWatchInterval = 5 * time.Second
+	// Зависшую задачу не ждём бесконечно: кэш всё равно устареет не больше чем на его TTL
+	cascadeWatchTimeout = time.Hour
+)
+
+// Адрес ищется в params по house_id документа; документы чужих домов не трогаем
+const cascadeAddressScript = `
+def address = params.addresses[String.valueOf(ctx._source.address.house_id)];
+if (address == null) {
+	ctx.op = 'noop';
+	return;
+}
+for (def entry : address.entrySet()) {
+	ctx._source.address[entry.getKey()] = entry.getValue();
+}`
+
+type CascadeTask struct {
+	Index  string
+	TaskID string
+}
+
+type TaskStatus struct {
+	TaskID           string
+	Completed        bool
+	Total            int64
+	Updated          int64
+	Noops            int64
+	VersionConflicts int64
+	Failures         []string
+	Error            string
+}
+
+// Пустые поля передаём явно как null, иначе старое значение останется в копии адреса
+func nodeAddressFields(address *searchpb.Address) map[string]interface{} {
+	value := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+
+	fields := map[string]interface{}{
+		"street_name": value(address.StreetName),
+		"street_type": value(address.StreetTypeShortName),
+		"house_name":  value(address.HouseName),
+		"house_type":  value(address.HouseTypeShortName),
+		"region":      value(address.Region),
+		"district":    value(address.District),
+		"locality":    value(address.Locality),
+		"location":    nil,
+	}
+
+	if address.Location != nil {
+		fields["location"] = geoPoint(address.Location)
+	}
+
+	return fields
+}
+
+// CascadeAddresses запускает фоновый _update_by_query по nodes и hardware для всех документов
+// с house_id из addresses. Ход выполнения - через GetCascadeTask, кэш по завершении сбрасывает WatchCascade
+func (s *DefaultAddressSearch) CascadeAddresses(ctx context.Context, addresses []*searchpb.Address) ([]CascadeTask, error) {
+	defer s.Cache.Invalidate(cascadeIndices...)
+
+	params := make(map[string]interface{}, len(addresses))
+	houseIDs := make([]int32, 0, len(addresses))
+
+	for _, address := range addresses {
+		if address.GetHouseId() == 0 {
+			continue
+		}
+
+		params[fmt.Sprint(address.HouseId)] = nodeAddressFields(address)
+		houseIDs = append(houseIDs, address.HouseId)
+	}
+
+	if len(houseIDs) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"query": map[string]interface{}{
+			"terms": map[string]interface{}{
+				"address.house_id": houseIDs,
+			},
+		},
+		"script": map[string]interface{}{
+			"lang":   "painless",
+			"source": cascadeAddressScript,
+			"params": map[string]interface{}{
+				"addresses": params,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []CascadeTask
+
+	for _, index := range cascadeIndices {
+		res, err := s.Elastic.UpdateByQuery(
+			[]string{index},
+			s.Elastic.UpdateByQuery.WithBody(bytes.NewReader(data)),
+			s.Elastic.UpdateByQuery.WithConflicts("proceed"),
+			s.Elastic.UpdateByQuery.WithRefresh(true),
+			s.Elastic.UpdateByQuery.WithWaitForCompletion(false),
+			s.Elastic.UpdateByQuery.WithContext(ctx),
+		)
+		if err != nil {
+			return tasks, err
+		}
+
+		var r struct {
+			Task string `json:"task"`
+		}
+
+		if res.IsError() {
+			err = fmt.Errorf("update by query on %s failed: %s", index, res.String())
+		} else {
+			err = json.NewDecoder(res.Body).Decode(&r)
+		}
+		res.Body.Close()
+		if err != nil {
+			return tasks, err
+		}
+
+		tasks = append(tasks, CascadeTask{Index: index, TaskID: r.Task})
+	}
+
+	return tasks, nil
+}
+
+// Обновление идёт в фоне, поэтому кэш сбрасываем ещё раз, когда задача завершилась
+func (s *DefaultAddressSearch) GetCascadeTask(ctx context.Context, taskID string) (*TaskStatus, error) {
+	status, err := getTaskStatus(ctx, s.Elastic, taskID)
+	if err == nil && status.Completed {
+		s.Cache.Invalidate(cascadeIndices...)
+	}
+
+	return status, err
+}
+
+func getTaskStatus(ctx context.Context, es *elasticsearch.Client, taskID string) (*TaskStatus, error) {
+	res, err := es.Tasks.Get(
+		taskID,
+		es.Tasks.Get.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("get task failed: %s", res.String())
+	}
+
+	var r struct {
+		Completed bool `json:"completed"`
+		Task      struct {
+			Status struct {
+				Total            int64 `json:"total"`
+				Updated          int64 `json:"updated"`
+				Noops            int64 `json:"noops"`
+				VersionConflicts int64 `json:"version_conflicts"`
+			} `json:"status"`
+		} `json:"task"`
+		Response struct {
+			Failures []struct {
+				Index string `json:"index"`
+				ID    string `json:"id"`
+				Cause struct {
+					Reason string `json:"reason"`
+				} `json:"cause"`
+			} `json:"failures"`
+		} `json:"response"`
+		Error *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	status := &TaskStatus{
+		TaskID:           taskID,
+		Completed:        r.Completed,
+		Total:            r.Task.Status.Total,
+		Updated:          r.Task.Status.Updated,
+		Noops:            r.Task.Status.Noops,
+		VersionConflicts: r.Task.Status.VersionConflicts,
+	}
+
+	for _, failure := range r.Response.Failures {
+		status.Failures = append(status.Failures, fmt.Sprintf("%s/%s: %s", failure.Index, failure.ID, failure.Cause.Reason))
+	}
+
+	if r.Error != nil {
+		status.Error = fmt.Sprintf("%s: %s", r.Error.Type, r.Error.Reason)
+	}
+
+	return status, nil
+}
+
+// WatchCascade в фоне дожидается задач каскада и сбрасывает кэш их индексов по завершении,
+// не полагаясь на то, что клиент будет опрашивать GetCascadeTask
+func (s *DefaultAddressSearch) WatchCascade(ctx context.Context, tasks []CascadeTask) {
+	for _, task := range tasks {
+		go func(task CascadeTask) {
+			ctx, cancel := context.WithTimeout(ctx, cascadeWatchTimeout)
+			defer cancel()
+
+			err := WatchTask(ctx, s.Elastic, task.TaskID, cascadeWatchInterval, func(status *TaskStatus) {
+				log.Printf("cascade %s on %s: %d/%d updated\n", task.TaskID, task.Index, status.Updated, status.Total)
+
+				if !status.Completed {
+					return
+				}
+
+				s.Cache.Invalidate(task.Index)
+
+				for _, failure := range status.Failures {
+					log.Printf("cascade %s failure: %s\n", task.TaskID, failure)
+				}
+
+				if status.Error != "" {
+					log.Printf("cascade %s failed: %s\n", task.TaskID, status.Error)
+				}
+			})
+			if err != nil {
+				log.Printf("failed to watch cascade %s: %v\n", task.TaskID, err)
+			}
+		}(task)
+	}
+}
+
+// WatchTask опрашивает задачу до завершения, передавая каждое состояние в report
+func WatchTask(ctx context.Context, es *elasticsearch.Client, taskID string, every time.Duration, report func(*TaskStatus)) error {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		status, err := getTaskStatus(ctx, es, taskID)
+		if err != nil {
+			return err
+		}
+
+		report(status)
+
+		if status.Completed {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
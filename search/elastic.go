@@ -3,6 +3,11 @@ package search
 import (
 	"fmt"
 	"github.com/elastic/go-elasticsearch/v8"
+	"net/http"
+	"search-service/metrics"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func NewElasticClient(address string) (*elasticsearch.Client, error) {
@@ -11,6 +16,9 @@ func NewElasticClient(address string) (*elasticsearch.Client, error) {
 		Addresses: []string{
 			fmt.Sprintf("http://%s", address),
 		},
+		Transport: &metricsTransport{next: http.DefaultTransport},
+		// Спан на каждый запрос; провайдер - глобальный, его настраивает tracing.Init
+		Instrumentation: elasticsearch.NewOpenTelemetryInstrumentation(nil, false),
 	}
 
 	es, err := elasticsearch.NewClient(cfg)
@@ -26,3 +34,72 @@ func NewElasticClient(address string) (*elasticsearch.Client, error) {
 
 	return es, nil
 }
+
+// metricsTransport снимает латентность и ошибки каждого запроса к ES
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	operation, index := elasticOperation(req.Method, req.URL.Path)
+	started := time.Now()
+
+	res, err := t.next.RoundTrip(req)
+
+	metrics.ElasticDuration.WithLabelValues(operation, index).Observe(time.Since(started).Seconds())
+
+	switch {
+	case err != nil:
+		metrics.ElasticErrors.WithLabelValues(operation, index, "error").Inc()
+	// 404 на HEAD - обычный ответ проверки существования индекса
+	case res.StatusCode >= 400 && !(req.Method == http.MethodHead && res.StatusCode == http.StatusNotFound):
+		metrics.ElasticErrors.WithLabelValues(operation, index, strconv.Itoa(res.StatusCode)).Inc()
+	}
+
+	return res, err
+}
+
+// elasticOperation выделяет из пути API-операцию (_search, _bulk, ...) и индекс перед ней.
+// ID документов и задач в метки не попадают
+func elasticOperation(method, path string) (string, string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "_") {
+			continue
+		}
+
+		index := ""
+		if i > 0 {
+			index = segments[0]
+		}
+
+		if segment == "_doc" {
+			switch method {
+			case http.MethodGet:
+				return "get", index
+			case http.MethodDelete:
+				return "delete", index
+			default:
+				return "index", index
+			}
+		}
+
+		return strings.TrimPrefix(segment, "_"), index
+	}
+
+	if segments[0] == "" {
+		return "info", ""
+	}
+
+	switch method {
+	case http.MethodHead:
+		return "exists", segments[0]
+	case http.MethodPut:
+		return "create_index", segments[0]
+	case http.MethodDelete:
+		return "delete_index", segments[0]
+	default:
+		return "get_index", segments[0]
+	}
+}
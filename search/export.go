@@ -0,0 +1,182 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"log"
+	"search-service/proto/searchpb"
+	"strings"
+)
+
+const (
+	defaultExportBatchSize = 1000
+	maxExportBatchSize     = 10000
+	exportKeepAlive        = "1m"
+)
+
+type exportResponse struct {
+	searchResponse
+	PitID string `json:"pit_id"`
+}
+
+func buildExportQuery(boolQuery map[string]interface{}, search *searchpb.Search) map[string]interface{} {
+	// Пустой запрос в экспорте означает "всё, что проходит фильтры"
+	if strings.TrimSpace(search.GetQuery()) == "" {
+		boolQuery["must"] = []map[string]interface{}{
+			{"match_all": map[string]interface{}{}},
+		}
+	}
+
+	searchQuery := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": boolQuery,
+		},
+		"sort": []map[string]interface{}{
+			{"_shard_doc": "asc"},
+		},
+	}
+
+	applySourceFilter(searchQuery, search.GetIncludeSource(), search.GetFields())
+
+	return searchQuery
+}
+
+// exportIndex проходит по всем совпадениям через PIT + search_after и отдаёт их пачками в send.
+// Total заполнен только в первой пачке
+func exportIndex(ctx context.Context, es *elasticsearch.Client, index string, searchQuery map[string]interface{}, batchSize int32, send func(*SearchResult) error) error {
+	return scanPIT(ctx, es, index, searchQuery, batchSize, func(r *searchResponse) error {
+		result, err := r.result(false)
+		if err != nil {
+			return err
+		}
+
+		return send(result)
+	})
+}
+
+// scanPIT отдаёт ответы как есть - для индексов, где _id не число
+func scanPIT(ctx context.Context, es *elasticsearch.Client, index string, searchQuery map[string]interface{}, batchSize int32, send func(*searchResponse) error) error {
+	if batchSize <= 0 {
+		batchSize = defaultExportBatchSize
+	}
+	if batchSize > maxExportBatchSize {
+		batchSize = maxExportBatchSize
+	}
+
+	pitRes, err := es.OpenPointInTime(
+		[]string{index},
+		exportKeepAlive,
+		es.OpenPointInTime.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer pitRes.Body.Close()
+
+	if pitRes.IsError() {
+		return fmt.Errorf("open pit failed: %s", pitRes.String())
+	}
+
+	var pit struct {
+		ID string `json:"id"`
+	}
+
+	if err = json.NewDecoder(pitRes.Body).Decode(&pit); err != nil {
+		return err
+	}
+
+	pitID := pit.ID
+	defer func() {
+		// Клиент мог уже отменить ctx, а PIT нужно закрыть в любом случае
+		if err := closePointInTime(context.Background(), es, pitID); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	searchQuery["size"] = batchSize
+	searchQuery["track_total_hits"] = true
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		searchQuery["pit"] = map[string]interface{}{
+			"id":         pitID,
+			"keep_alive": exportKeepAlive,
+		}
+
+		var buf bytes.Buffer
+		if err = json.NewEncoder(&buf).Encode(searchQuery); err != nil {
+			return err
+		}
+
+		// С PIT индекс в запросе не указывается
+		res, err := es.Search(
+			es.Search.WithContext(ctx),
+			es.Search.WithBody(&buf),
+		)
+		if err != nil {
+			return err
+		}
+
+		var r exportResponse
+		if res.IsError() {
+			err = fmt.Errorf("export search failed: %s", res.String())
+		} else {
+			// UseNumber сохраняет значения сортировки без потерь для search_after
+			dec := json.NewDecoder(res.Body)
+			dec.UseNumber()
+			err = dec.Decode(&r)
+		}
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		hits := r.Hits.Hits
+		if len(hits) == 0 {
+			return nil
+		}
+
+		if err = send(&r.searchResponse); err != nil {
+			return err
+		}
+
+		if len(hits) < int(batchSize) {
+			return nil
+		}
+
+		if r.PitID != "" {
+			pitID = r.PitID
+		}
+
+		searchQuery["search_after"] = hits[len(hits)-1].Sort
+		searchQuery["track_total_hits"] = false
+	}
+}
+
+func closePointInTime(ctx context.Context, es *elasticsearch.Client, pitID string) error {
+	data, err := json.Marshal(map[string]interface{}{"id": pitID})
+	if err != nil {
+		return err
+	}
+
+	res, err := es.ClosePointInTime(
+		es.ClosePointInTime.WithBody(bytes.NewReader(data)),
+		es.ClosePointInTime.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("close pit failed: %s", res.String())
+	}
+
+	return nil
+}
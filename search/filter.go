@@ -0,0 +1,49 @@
+package search
+
+import (
+	"search-service/proto/searchpb"
+)
+
+// Документы без поля считаются false, поэтому "только false" строится через must_not term true
+func buildFlagFilter(field string, mode searchpb.FlagFilter) map[string]interface{} {
+	switch mode {
+	case searchpb.FlagFilter_FLAG_TRUE:
+		return map[string]interface{}{
+			"term": map[string]interface{}{
+				field: true,
+			},
+		}
+	case searchpb.FlagFilter_FLAG_FALSE:
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": map[string]interface{}{
+					"term": map[string]interface{}{
+						field: true,
+					},
+				},
+			},
+		}
+	default:
+		return nil
+	}
+}
+
+func resolveFlagFilter(mode searchpb.FlagFilter, useLegacy, legacyValue bool) searchpb.FlagFilter {
+	if mode != searchpb.FlagFilter_FLAG_ANY || !useLegacy {
+		return mode
+	}
+
+	if legacyValue {
+		return searchpb.FlagFilter_FLAG_TRUE
+	}
+
+	return searchpb.FlagFilter_FLAG_FALSE
+}
+
+func appendFlagFilter(filters []map[string]interface{}, field string, mode searchpb.FlagFilter) []map[string]interface{} {
+	if f := buildFlagFilter(field, mode); f != nil {
+		filters = append(filters, f)
+	}
+
+	return filters
+}
@@ -0,0 +1,121 @@
+package search
+
+import (
+	"encoding/json"
+	"search-service/proto/searchpb"
+	"testing"
+)
+
+func TestBuildFlagFilter(t *testing.T) {
+	tests := []struct {
+		name string
+		mode searchpb.FlagFilter
+		want string
+	}{
+		{"true", searchpb.FlagFilter_FLAG_TRUE, `{"term":{"is_delete":true}}`},
+		// Документы без поля должны попадать в "только false"
+		{"false", searchpb.FlagFilter_FLAG_FALSE, `{"bool":{"must_not":{"term":{"is_delete":true}}}}`},
+		{"any", searchpb.FlagFilter_FLAG_ANY, `null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(buildFlagFilter("is_delete", tt.mode))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != tt.want {
+				t.Errorf("got %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveFlagFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        searchpb.FlagFilter
+		useLegacy   bool
+		legacyValue bool
+		want        searchpb.FlagFilter
+	}{
+		{"any without legacy", searchpb.FlagFilter_FLAG_ANY, false, true, searchpb.FlagFilter_FLAG_ANY},
+		{"legacy true", searchpb.FlagFilter_FLAG_ANY, true, true, searchpb.FlagFilter_FLAG_TRUE},
+		{"legacy false", searchpb.FlagFilter_FLAG_ANY, true, false, searchpb.FlagFilter_FLAG_FALSE},
+		{"explicit mode wins", searchpb.FlagFilter_FLAG_TRUE, true, false, searchpb.FlagFilter_FLAG_TRUE},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveFlagFilter(tt.mode, tt.useLegacy, tt.legacyValue); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildNodeFilterLegacy(t *testing.T) {
+	filters := buildNodeFilter(&searchpb.SearchNodeFilter{UseIsDelete: true, IsDelete: false})
+
+	data, err := json.Marshal(filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[{"bool":{"must_not":{"term":{"is_delete":true}}}}]`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+}
+
+// Документы без поля должны считаться false: "только не пассивные" - это must_not term true,
+// а не term false, и при FLAG_ANY фильтра по полю нет вовсе
+func TestBuildNodeSearchQueryFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter *searchpb.SearchNodeFilter
+		want   string
+	}{
+		{
+			name:   "only false",
+			filter: &searchpb.SearchNodeFilter{IsPassiveFilter: searchpb.FlagFilter_FLAG_FALSE},
+			want:   `[{"bool":{"must_not":{"term":{"is_passive":true}}}}]`,
+		},
+		{
+			name:   "only true",
+			filter: &searchpb.SearchNodeFilter{IsDeleteFilter: searchpb.FlagFilter_FLAG_TRUE},
+			want:   `[{"term":{"is_delete":true}}]`,
+		},
+		{
+			name:   "unspecified",
+			filter: &searchpb.SearchNodeFilter{},
+			want:   `null`,
+		},
+		{
+			name:   "no filter",
+			filter: nil,
+			want:   `null`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := buildNodeSearchQuery(&searchpb.Search{Limit: 10}, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			boolQuery := query["query"].(map[string]interface{})["bool"].(map[string]interface{})
+
+			data, err := json.Marshal(boolQuery["filter"])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != tt.want {
+				t.Errorf("filter = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
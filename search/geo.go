@@ -0,0 +1,85 @@
+package search
+
+import (
+	"fmt"
+	"search-service/proto/searchpb"
+)
+
+var geoPointMapping = map[string]interface{}{
+	"type": "geo_point",
+}
+
+func geoPoint(point *searchpb.GeoPoint) map[string]interface{} {
+	return map[string]interface{}{
+		"lat": point.GetLat(),
+		"lon": point.GetLon(),
+	}
+}
+
+// ignore_unmapped: в старых индексах без поля координат фильтр не падает, а ничего не находит
+func buildGeoFilter(field string, geo *searchpb.GeoFilter) []map[string]interface{} {
+	var filters []map[string]interface{}
+
+	if distance := geo.GetDistance(); distance.GetCenter() != nil && distance.GetMeters() > 0 {
+		filters = append(filters, map[string]interface{}{
+			"geo_distance": map[string]interface{}{
+				"distance":        fmt.Sprintf("%fm", distance.GetMeters()),
+				field:             geoPoint(distance.GetCenter()),
+				"ignore_unmapped": true,
+			},
+		})
+	}
+
+	if box := geo.GetBoundingBox(); box.GetTopLeft() != nil && box.GetBottomRight() != nil {
+		filters = append(filters, map[string]interface{}{
+			"geo_bounding_box": map[string]interface{}{
+				field: map[string]interface{}{
+					"top_left":     geoPoint(box.GetTopLeft()),
+					"bottom_right": geoPoint(box.GetBottomRight()),
+				},
+				"ignore_unmapped": true,
+			},
+		})
+	}
+
+	if points := geo.GetPolygon().GetPoints(); len(points) >= 3 {
+		// GeoJSON: [lon, lat], контур должен быть замкнут
+		ring := make([][]float64, 0, len(points)+1)
+		for _, p := range points {
+			ring = append(ring, []float64{p.GetLon(), p.GetLat()})
+		}
+
+		first, last := points[0], points[len(points)-1]
+		if first.GetLat() != last.GetLat() || first.GetLon() != last.GetLon() {
+			ring = append(ring, ring[0])
+		}
+
+		filters = append(filters, map[string]interface{}{
+			"geo_shape": map[string]interface{}{
+				field: map[string]interface{}{
+					"shape": map[string]interface{}{
+						"type":        "polygon",
+						"coordinates": [][][]float64{ring},
+					},
+					"relation": "intersects",
+				},
+				"ignore_unmapped": true,
+			},
+		})
+	}
+
+	return filters
+}
+
+func buildGeoDistanceSort(field string, point *searchpb.GeoPoint) map[string]interface{} {
+	return map[string]interface{}{
+		"_geo_distance": map[string]interface{}{
+			field:           geoPoint(point),
+			"order":         "asc",
+			"unit":          "m",
+			"distance_type": "arc",
+			// Индексы, созданные до появления координат, не должны ронять поиск
+			"ignore_unmapped": true,
+		},
+	}
+}
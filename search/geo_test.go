@@ -0,0 +1,53 @@
+package search
+
+import (
+	"encoding/json"
+	"search-service/proto/searchpb"
+	"testing"
+)
+
+func TestBuildGeoFilter(t *testing.T) {
+	center := &searchpb.GeoPoint{Lat: 1, Lon: 2}
+
+	tests := []struct {
+		name string
+		geo  *searchpb.GeoFilter
+		want string
+	}{
+		{
+			"distance",
+			&searchpb.GeoFilter{Distance: &searchpb.GeoDistance{Center: center, Meters: 500}},
+			`[{"geo_distance":{"distance":"500.000000m","ignore_unmapped":true,"location":{"lat":1,"lon":2}}}]`,
+		},
+		{
+			"bounding box",
+			&searchpb.GeoFilter{BoundingBox: &searchpb.GeoBoundingBox{
+				TopLeft:     &searchpb.GeoPoint{Lat: 2, Lon: 1},
+				BottomRight: &searchpb.GeoPoint{Lat: 1, Lon: 2},
+			}},
+			`[{"geo_bounding_box":{"ignore_unmapped":true,"location":{"bottom_right":{"lat":1,"lon":2},"top_left":{"lat":2,"lon":1}}}}]`,
+		},
+		{
+			// Незамкнутый контур замыкается первой точкой
+			"polygon",
+			&searchpb.GeoFilter{Polygon: &searchpb.GeoPolygon{Points: []*searchpb.GeoPoint{
+				{Lat: 0, Lon: 0}, {Lat: 0, Lon: 1}, {Lat: 1, Lon: 1},
+			}}},
+			`[{"geo_shape":{"ignore_unmapped":true,"location":{"relation":"intersects","shape":{"coordinates":[[[0,0],[1,0],[1,1],[0,0]]],"type":"polygon"}}}}]`,
+		},
+		{"empty", &searchpb.GeoFilter{}, `null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(buildGeoFilter("location", tt.geo))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != tt.want {
+				t.Errorf("got %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
@@ -6,51 +6,64 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
 	"search-service/proto/searchpb"
-	"strconv"
+	"strings"
 )
 
 type HardwareSearch interface {
 	EnsureIndexHardware(ctx context.Context) error
+	NewHardwareIndexer() (*StreamIndexer[*searchpb.Hardware], error)
+	PatchHardware(ctx context.Context, patch *searchpb.HardwarePatch) error
+	ExportHardware(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchHardwareFilter, batchSize int32, send func(*SearchResult) error) error
 	IndexHardware(ctx context.Context, hardware []*searchpb.Hardware) error
 	IndexHardwareSingle(ctx context.Context, hardware *searchpb.Hardware) error
-	SearchHardware(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchHardwareFilter) ([]int32, int32, error)
+	SearchHardware(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchHardwareFilter) (*SearchResult, error)
 }
 
 type DefaultHardwareSearch struct {
 	Elastic *elasticsearch.Client
+	Cache   *SearchCache
 }
 
 func (s *DefaultHardwareSearch) IndexHardwareSingle(ctx context.Context, hardware *searchpb.Hardware) error {
+	defer s.Cache.Invalidate("hardware")
+
 	hardware.IsDelete = hardware.GetIsDelete()
 
-	data, err := json.Marshal(hardware)
+	data, err := json.Marshal(newHardwareDocument(hardware))
 	if err != nil {
 		return err
 	}
 
 	req := bytes.NewReader(data)
 
-	_, err = s.Elastic.Index(
-		"hardware",
-		req,
+	opts := append([]func(*esapi.IndexRequest){
 		s.Elastic.Index.WithDocumentID(fmt.Sprint(hardware.Id)),
 		s.Elastic.Index.WithRefresh("true"),
 		s.Elastic.Index.WithContext(ctx),
-	)
+	}, indexVersionOptions(s.Elastic, hardware.GetUpdatedAt())...)
+
+	res, err := s.Elastic.Index("hardware", req, opts...)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
 
-	return err
+	return checkIndexResponse(res, "hardware")
 }
 
 func (s *DefaultHardwareSearch) IndexHardware(ctx context.Context, hardware []*searchpb.Hardware) error {
+	defer s.Cache.Invalidate("hardware")
+
 	var buf bytes.Buffer
 
 	for _, h := range hardware {
-		meta := []byte(fmt.Sprintf(`{ "index" : { "_id" : "%d" } }%s`, h.Id, "\n"))
+		meta := bulkIndexMeta(h.Id, h.GetUpdatedAt())
 
 		h.IsDelete = h.GetIsDelete()
 
-		data, err := json.Marshal(h)
+		data, err := json.Marshal(newHardwareDocument(h))
 		if err != nil {
 			return err
 		}
@@ -74,44 +87,38 @@ func (s *DefaultHardwareSearch) IndexHardware(ctx context.Context, hardware []*s
 	}
 	defer res.Body.Close()
 
-	var bulkResp struct {
-		Errors bool `json:"errors"`
-	}
+	return checkBulkResponse(res)
+}
 
-	if err = json.NewDecoder(res.Body).Decode(&bulkResp); err != nil {
-		return err
-	}
+func (s *DefaultHardwareSearch) SearchHardware(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchHardwareFilter) (*SearchResult, error) {
+	request := map[string]interface{}{"search": search, "filter": filter}
+
+	return cachedSearch(s.Cache, "hardware", []string{"hardware"}, request, search.GetBypassCache(), func() (*SearchResult, error) {
+		return s.searchHardwareCorrected(ctx, search, filter)
+	})
+}
 
-	if bulkResp.Errors {
-		return fmt.Errorf("bulk indexing had errors")
+func (s *DefaultHardwareSearch) searchHardwareCorrected(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchHardwareFilter) (*SearchResult, error) {
+	result, err := s.searchHardware(ctx, search, filter)
+	if err != nil || result.Total > 0 || strings.TrimSpace(search.GetQuery()) == "" || !hardwareQueryLanguage.isPlainQuery(search.GetQuery()) {
+		return result, err
 	}
 
-	return nil
+	return correctZeroResults(ctx, s.Elastic, "hardware", hardwareSpellFields, search.GetQuery(), search.GetAutoCorrect(), result, func(query string) (*SearchResult, error) {
+		return s.searchHardware(ctx, withQuery(search, query), filter)
+	})
 }
 
-func (s *DefaultHardwareSearch) SearchHardware(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchHardwareFilter) ([]int32, int32, error) {
+func (s *DefaultHardwareSearch) searchHardware(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchHardwareFilter) (*SearchResult, error) {
 	var buf bytes.Buffer
 
-	searchQuery := map[string]interface{}{
-		"from": search.Offset,
-		"size": search.Limit,
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": []map[string]interface{}{
-					{
-						"multi_match": map[string]interface{}{
-							"query":  search.Query,
-							"fields": []string{"type.edge", "node_name.edge", "model_name.edge", "ip_address.edge", "address.street_name.edge", "address.street_type.edge", "address.house_name.edge", "address.house_type.edge"},
-						},
-					},
-				},
-				"filter": buildHardwareFilter(filter),
-			},
-		},
+	searchQuery, err := buildHardwareSearchQuery(search, filter)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := json.NewEncoder(&buf).Encode(searchQuery); err != nil {
-		return nil, 0, err
+	if err = json.NewEncoder(&buf).Encode(searchQuery); err != nil {
+		return nil, err
 	}
 
 	res, err := s.Elastic.Search(
@@ -120,37 +127,34 @@ func (s *DefaultHardwareSearch) SearchHardware(ctx context.Context, search *sear
 		s.Elastic.Search.WithBody(&buf),
 	)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer res.Body.Close()
 
-	var r struct {
-		Hits struct {
-			Total struct {
-				Value int32 `json:"value"`
-			}
-			Hits []struct {
-				ID string `json:"_id"`
-			} `json:"hits"`
-		} `json:"hits"`
-	}
+	return decodeSearchResult(res, search.GetNear() != nil)
+}
 
-	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
-		return nil, 0, err
+func (s *DefaultHardwareSearch) ExportHardware(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchHardwareFilter, batchSize int32, send func(*SearchResult) error) error {
+	boolQuery, err := buildHardwareBoolQuery(search, filter)
+	if err != nil {
+		return err
 	}
 
-	var ids []int32
+	return exportIndex(ctx, s.Elastic, "hardware", buildExportQuery(boolQuery, search), batchSize, send)
+}
 
-	for _, hit := range r.Hits.Hits {
-		id, err := strconv.Atoi(hit.ID)
-		if err != nil {
-			return nil, 0, fmt.Errorf("invalid id %s: %v", hit.ID, err)
-		}
+func (s *DefaultHardwareSearch) PatchHardware(ctx context.Context, patch *searchpb.HardwarePatch) error {
+	defer s.Cache.Invalidate("hardware")
 
-		ids = append(ids, int32(id))
-	}
+	return patchDocument(ctx, s.Elastic, "hardware", patch.GetId(), buildHardwarePatch(patch))
+}
 
-	return ids, r.Hits.Total.Value, nil
+func (s *DefaultHardwareSearch) NewHardwareIndexer() (*StreamIndexer[*searchpb.Hardware], error) {
+	return newStreamIndexer(s.Elastic, s.Cache, "hardware",
+		func(hardware *searchpb.Hardware) string { return fmt.Sprint(hardware.GetId()) },
+		func(hardware *searchpb.Hardware) interface{} { return newHardwareDocument(hardware) },
+		func(hardware *searchpb.Hardware) int64 { return hardware.GetUpdatedAt() },
+	)
 }
 
 func (s *DefaultHardwareSearch) EnsureIndexHardware(ctx context.Context) error {
@@ -160,9 +164,7 @@ func (s *DefaultHardwareSearch) EnsureIndexHardware(ctx context.Context) error {
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode == 200 {
-		return nil
-	}
+	exists := res.StatusCode == 200
 
 	fieldParams := map[string]interface{}{
 		"type": "text",
@@ -191,6 +193,7 @@ func (s *DefaultHardwareSearch) EnsureIndexHardware(ctx context.Context) error {
 						"tokenizer": "standard",
 						"filter":    []string{"lowercase", "edge_ngram_filter"},
 					},
+					"completion_analyzer": completionAnalyzer,
 				},
 			},
 		},
@@ -208,10 +211,20 @@ func (s *DefaultHardwareSearch) EnsureIndexHardware(ctx context.Context) error {
 					"type":       "boolean",
 					"null_value": false,
 				},
+				"address.location": geoPointMapping,
+				"address.region":   adminKeywordMapping,
+				"address.district": adminKeywordMapping,
+				"address.locality": adminKeywordMapping,
+				"suggest":          completionMapping("type"),
+				"updated_at":       updatedAtMapping,
 			},
 		},
 	}
 
+	if exists {
+		return putMissingMappings(ctx, s.Elastic, "hardware", settings)
+	}
+
 	var buf bytes.Buffer
 	if err = json.NewEncoder(&buf).Encode(settings); err != nil {
 		return err
@@ -230,28 +243,77 @@ func (s *DefaultHardwareSearch) EnsureIndexHardware(ctx context.Context) error {
 	return nil
 }
 
-func buildHardwareFilter(filter *searchpb.SearchHardwareFilter) []map[string]interface{} {
-	var filters []map[string]interface{}
+type hardwareDocument struct {
+	*searchpb.Hardware
+	Suggest *completionInput `json:"suggest,omitempty"`
+}
 
-	if filter.GetUseIsDelete() {
-		if filter.GetIsDelete() {
-			filters = append(filters, map[string]interface{}{
-				"term": map[string]interface{}{
-					"is_delete": true,
-				},
-			})
-		} else {
-			filters = append(filters, map[string]interface{}{
-				"bool": map[string]interface{}{
-					"must_not": map[string]interface{}{
-						"exists": map[string]interface{}{
-							"field": "is_delete",
-						},
-					},
-				},
-			})
+func newHardwareDocument(hardware *searchpb.Hardware) *hardwareDocument {
+	return &hardwareDocument{
+		Hardware: hardware,
+		Suggest: newCompletionInput(hardware.GetModelName(), hardware.GetPopularity(), map[string][]string{
+			"type": {hardware.GetType()},
+		}),
+	}
+}
+
+func buildHardwareBoolQuery(search *searchpb.Search, filter *searchpb.SearchHardwareFilter) (map[string]interface{}, error) {
+	must, filters, mustNot, err := hardwareQueryLanguage.compile(search.GetQuery())
+	if err != nil {
+		return nil, err
+	}
+
+	boolQuery := map[string]interface{}{
+		"filter": append(buildHardwareFilter(filter), filters...),
+	}
+
+	if len(must) > 0 {
+		boolQuery["must"] = must
+	}
+
+	if len(mustNot) > 0 {
+		boolQuery["must_not"] = mustNot
+	}
+
+	if should := buildAdminBoost("address.", filter.GetPreferAdmin()); len(should) > 0 {
+		boolQuery["should"] = should
+	}
+
+	return boolQuery, nil
+}
+
+func buildHardwareSearchQuery(search *searchpb.Search, filter *searchpb.SearchHardwareFilter) (map[string]interface{}, error) {
+	boolQuery, err := buildHardwareBoolQuery(search, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	searchQuery := map[string]interface{}{
+		"from": search.Offset,
+		"size": search.Limit,
+		"query": map[string]interface{}{
+			"bool": boolQuery,
+		},
+	}
+
+	if near := search.GetNear(); near != nil {
+		searchQuery["sort"] = []map[string]interface{}{
+			buildGeoDistanceSort("address.location", near),
+			{"_score": map[string]interface{}{"order": "desc"}},
 		}
 	}
 
+	applySourceFilter(searchQuery, search.GetIncludeSource(), search.GetFields())
+
+	return searchQuery, nil
+}
+
+func buildHardwareFilter(filter *searchpb.SearchHardwareFilter) []map[string]interface{} {
+	var filters []map[string]interface{}
+
+	filters = appendFlagFilter(filters, "is_delete", resolveFlagFilter(filter.GetIsDeleteFilter(), filter.GetUseIsDelete(), filter.GetIsDelete()))
+	filters = append(filters, buildGeoFilter("address.location", filter.GetGeo())...)
+	filters = append(filters, buildAdminFilter("address.", filter.GetAdmin())...)
+
 	return filters
 }
@@ -0,0 +1,131 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Ensure* создают индекс только один раз, а поля появляются в коде позже. Без явной разметки
+// ES добавит их динамически (region как text, а не keyword) и фильтры с агрегациями по ним
+// перестанут работать, поэтому недостающие поля дописываются в существующий индекс.
+// Поле, уже размеченное другим типом, так не исправить - нужна переиндексация
+func putMissingMappings(ctx context.Context, es *elasticsearch.Client, index string, settings map[string]interface{}) error {
+	mappings, _ := settings["mappings"].(map[string]interface{})
+	want, _ := mappings["properties"].(map[string]interface{})
+
+	have, err := indexProperties(ctx, es, index)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field, _ := want[name].(map[string]interface{})
+
+		current, ok := lookupProperty(have, name)
+		if !ok {
+			// По одному полю: без анализатора из settings (его не добавить в открытый индекс)
+			// не добавится только это поле, а не все сразу
+			if err = putFieldMapping(ctx, es, index, name, field); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if current["type"] != field["type"] {
+			log.Printf("index %s: field %s is mapped as %v instead of %v, reindex required\n", index, name, current["type"], field["type"])
+		}
+	}
+
+	return nil
+}
+
+func indexProperties(ctx context.Context, es *elasticsearch.Client, index string) (map[string]interface{}, error) {
+	res, err := es.Indices.GetMapping(
+		es.Indices.GetMapping.WithIndex(index),
+		es.Indices.GetMapping.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("get mapping %s failed: %s", index, res.String())
+	}
+
+	// Ключ ответа - имя конкретного индекса, которое может отличаться от алиаса
+	var r map[string]struct {
+		Mappings struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"mappings"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	for _, mapping := range r {
+		return mapping.Mappings.Properties, nil
+	}
+
+	return nil, nil
+}
+
+// "address.region" ищется во вложенных properties объекта address
+func lookupProperty(properties map[string]interface{}, name string) (map[string]interface{}, bool) {
+	parts := strings.Split(name, ".")
+
+	for i, part := range parts {
+		field, ok := properties[part].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if i == len(parts)-1 {
+			return field, true
+		}
+
+		properties, _ = field["properties"].(map[string]interface{})
+	}
+
+	return nil, false
+}
+
+func putFieldMapping(ctx context.Context, es *elasticsearch.Client, index, name string, field map[string]interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{
+		"properties": map[string]interface{}{
+			name: field,
+		},
+	}); err != nil {
+		return err
+	}
+
+	res, err := es.Indices.PutMapping(
+		[]string{index},
+		&buf,
+		es.Indices.PutMapping.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		log.Printf("index %s: failed to add field %s, reindex required: %s\n", index, name, res.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package search
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLookupProperty(t *testing.T) {
+	var properties map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+		"name": {"type": "text"},
+		"address": {"properties": {
+			"region": {"type": "text", "fields": {"keyword": {"type": "keyword"}}}
+		}}
+	}`), &properties); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		found    bool
+		wantType interface{}
+	}{
+		{"name", true, "text"},
+		// Динамически размеченный region - text, его тип отличается от нужного keyword
+		{"address.region", true, "text"},
+		{"address.locality", false, nil},
+		{"name.keyword", false, nil},
+		{"updated_at", false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field, ok := lookupProperty(properties, tt.name)
+			if ok != tt.found {
+				t.Fatalf("found = %v, want %v", ok, tt.found)
+			}
+
+			if ok && field["type"] != tt.wantType {
+				t.Errorf("type = %v, want %v", field["type"], tt.wantType)
+			}
+		})
+	}
+}
@@ -6,53 +6,82 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
 	"search-service/proto/searchpb"
-	"strconv"
+	"strings"
 )
 
 type NodeSearch interface {
-	SearchNodes(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchNodeFilter) ([]int32, int32, error)
+	SearchNodes(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchNodeFilter) (*SearchResult, error)
 	IndexNodes(ctx context.Context, nodes []*searchpb.Node) error
 	IndexNode(ctx context.Context, node *searchpb.Node) error
 	EnsureIndexNode(ctx context.Context) error
+	NewNodeIndexer() (*StreamIndexer[*searchpb.Node], error)
+	PatchNode(ctx context.Context, patch *searchpb.NodePatch) error
+	ExportNodes(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchNodeFilter, batchSize int32, send func(*SearchResult) error) error
 }
 
 type DefaultNodeSearch struct {
 	Elastic *elasticsearch.Client
+	// SkipRenamePropagation отключает обновление node_name в hardware при переименовании узла
+	SkipRenamePropagation bool
+	Cache                 *SearchCache
 }
 
 func (s *DefaultNodeSearch) IndexNode(ctx context.Context, node *searchpb.Node) error {
+	defer s.Cache.Invalidate("nodes")
+
+	stored, err := s.storedNodes(ctx, []*searchpb.Node{node})
+	if err != nil {
+		return err
+	}
+
 	node.IsDelete = node.GetIsDelete()
 	node.IsPassive = node.GetIsPassive()
 
-	data, err := json.Marshal(node)
+	data, err := json.Marshal(newNodeDocument(node))
 	if err != nil {
 		return err
 	}
 
 	req := bytes.NewReader(data)
 
-	_, err = s.Elastic.Index(
-		"nodes",
-		req,
+	opts := append([]func(*esapi.IndexRequest){
 		s.Elastic.Index.WithDocumentID(fmt.Sprint(node.Id)),
 		s.Elastic.Index.WithRefresh("true"),
 		s.Elastic.Index.WithContext(ctx),
-	)
+	}, indexVersionOptions(s.Elastic, node.GetUpdatedAt())...)
 
-	return err
+	res, err := s.Elastic.Index("nodes", req, opts...)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if err = checkIndexResponse(res, "nodes"); err != nil {
+		return err
+	}
+
+	return propagateNodeRenames(ctx, s.Elastic, s.Cache, stored, []*searchpb.Node{node})
 }
 
 func (s *DefaultNodeSearch) IndexNodes(ctx context.Context, nodes []*searchpb.Node) error {
+	defer s.Cache.Invalidate("nodes")
+
+	stored, err := s.storedNodes(ctx, nodes)
+	if err != nil {
+		return err
+	}
+
 	var buf bytes.Buffer
 
 	for _, node := range nodes {
-		meta := []byte(fmt.Sprintf(`{ "index" : { "_id" : "%d" } }%s`, node.Id, "\n"))
+		meta := bulkIndexMeta(node.Id, node.GetUpdatedAt())
 
 		node.IsDelete = node.GetIsDelete()
 		node.IsPassive = node.GetIsPassive()
 
-		data, err := json.Marshal(node)
+		data, err := json.Marshal(newNodeDocument(node))
 		if err != nil {
 			return err
 		}
@@ -76,44 +105,56 @@ func (s *DefaultNodeSearch) IndexNodes(ctx context.Context, nodes []*searchpb.No
 	}
 	defer res.Body.Close()
 
-	var bulkResp struct {
-		Errors bool `json:"errors"`
+	if err = checkBulkResponse(res); err != nil {
+		return err
 	}
 
-	if err = json.NewDecoder(res.Body).Decode(&bulkResp); err != nil {
-		return err
+	return propagateNodeRenames(ctx, s.Elastic, s.Cache, stored, nodes)
+}
+
+// storedNodes - nil, если переименования распространять не нужно
+func (s *DefaultNodeSearch) storedNodes(ctx context.Context, nodes []*searchpb.Node) (map[int32]storedNode, error) {
+	if s.SkipRenamePropagation {
+		return nil, nil
 	}
 
-	if bulkResp.Errors {
-		return fmt.Errorf("bulk indexing had errors")
+	ids := make([]int32, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, node.GetId())
 	}
 
-	return nil
+	return storedNodes(ctx, s.Elastic, ids)
+}
+
+func (s *DefaultNodeSearch) SearchNodes(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchNodeFilter) (*SearchResult, error) {
+	request := map[string]interface{}{"search": search, "filter": filter}
+
+	return cachedSearch(s.Cache, "nodes", []string{"nodes"}, request, search.GetBypassCache(), func() (*SearchResult, error) {
+		return s.searchNodesCorrected(ctx, search, filter)
+	})
+}
+
+func (s *DefaultNodeSearch) searchNodesCorrected(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchNodeFilter) (*SearchResult, error) {
+	result, err := s.searchNodes(ctx, search, filter)
+	if err != nil || result.Total > 0 || strings.TrimSpace(search.GetQuery()) == "" || !nodeQueryLanguage.isPlainQuery(search.GetQuery()) {
+		return result, err
+	}
+
+	return correctZeroResults(ctx, s.Elastic, "nodes", nodeSpellFields, search.GetQuery(), search.GetAutoCorrect(), result, func(query string) (*SearchResult, error) {
+		return s.searchNodes(ctx, withQuery(search, query), filter)
+	})
 }
 
-func (s *DefaultNodeSearch) SearchNodes(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchNodeFilter) ([]int32, int32, error) {
+func (s *DefaultNodeSearch) searchNodes(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchNodeFilter) (*SearchResult, error) {
 	var buf bytes.Buffer
 
-	searchQuery := map[string]interface{}{
-		"from": search.Offset,
-		"size": search.Limit,
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": []map[string]interface{}{
-					{
-						"multi_match": map[string]interface{}{
-							"query":  search.Query,
-							"fields": []string{"name.edge", "zone.edge", "owner.edge", "address.street_name.edge", "address.street_type.edge", "address.house_name.edge", "address.house_type.edge", "type.edge"},
-						},
-					},
-				},
-				"filter": buildNodeFilter(filter),
-			},
-		},
+	searchQuery, err := buildNodeSearchQuery(search, filter)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := json.NewEncoder(&buf).Encode(searchQuery); err != nil {
-		return nil, 0, err
+	if err = json.NewEncoder(&buf).Encode(searchQuery); err != nil {
+		return nil, err
 	}
 
 	res, err := s.Elastic.Search(
@@ -122,37 +163,45 @@ func (s *DefaultNodeSearch) SearchNodes(ctx context.Context, search *searchpb.Se
 		s.Elastic.Search.WithBody(&buf),
 	)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer res.Body.Close()
 
-	var r struct {
-		Hits struct {
-			Total struct {
-				Value int32 `json:"value"`
-			} `json:"total"`
-			Hits []struct {
-				ID string `json:"_id"`
-			} `json:"hits"`
-		} `json:"hits"`
-	}
+	return decodeSearchResult(res, search.GetNear() != nil)
+}
 
-	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
-		return nil, 0, err
+func (s *DefaultNodeSearch) ExportNodes(ctx context.Context, search *searchpb.Search, filter *searchpb.SearchNodeFilter, batchSize int32, send func(*SearchResult) error) error {
+	boolQuery, err := buildNodeBoolQuery(search, filter)
+	if err != nil {
+		return err
 	}
 
-	var ids []int32
+	return exportIndex(ctx, s.Elastic, "nodes", buildExportQuery(boolQuery, search), batchSize, send)
+}
 
-	for _, hit := range r.Hits.Hits {
-		id, err := strconv.Atoi(hit.ID)
-		if err != nil {
-			return nil, 0, fmt.Errorf("invalid id %s: %v", hit.ID, err)
-		}
+func (s *DefaultNodeSearch) PatchNode(ctx context.Context, patch *searchpb.NodePatch) error {
+	defer s.Cache.Invalidate("nodes")
 
-		ids = append(ids, int32(id))
+	return patchDocument(ctx, s.Elastic, "nodes", patch.GetId(), buildNodePatch(patch))
+}
+
+func (s *DefaultNodeSearch) NewNodeIndexer() (*StreamIndexer[*searchpb.Node], error) {
+	indexer, err := newStreamIndexer(s.Elastic, s.Cache, "nodes",
+		func(node *searchpb.Node) string { return fmt.Sprint(node.GetId()) },
+		func(node *searchpb.Node) interface{} { return newNodeDocument(node) },
+		func(node *searchpb.Node) int64 { return node.GetUpdatedAt() },
+	)
+	if err != nil || s.SkipRenamePropagation {
+		return indexer, err
 	}
 
-	return ids, r.Hits.Total.Value, nil
+	renames := &streamRenames{names: map[string]string{}}
+	indexer.onIndexed = renames.add
+	indexer.onClose = func(ctx context.Context) error {
+		return renames.propagate(ctx, s.Elastic, s.Cache)
+	}
+
+	return indexer, nil
 }
 
 func (s *DefaultNodeSearch) EnsureIndexNode(ctx context.Context) error {
@@ -162,9 +211,7 @@ func (s *DefaultNodeSearch) EnsureIndexNode(ctx context.Context) error {
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode == 200 {
-		return nil
-	}
+	exists := res.StatusCode == 200
 
 	fieldParams := map[string]interface{}{
 		"type": "text",
@@ -193,6 +240,7 @@ func (s *DefaultNodeSearch) EnsureIndexNode(ctx context.Context) error {
 						"tokenizer": "standard",
 						"filter":    []string{"lowercase", "edge_ngram_filter"},
 					},
+					"completion_analyzer": completionAnalyzer,
 				},
 			},
 		},
@@ -214,10 +262,20 @@ func (s *DefaultNodeSearch) EnsureIndexNode(ctx context.Context) error {
 					"type":       "boolean",
 					"null_value": false,
 				},
+				"address.location": geoPointMapping,
+				"address.region":   adminKeywordMapping,
+				"address.district": adminKeywordMapping,
+				"address.locality": adminKeywordMapping,
+				"suggest":          completionMapping("zone", "type"),
+				"updated_at":       updatedAtMapping,
 			},
 		},
 	}
 
+	if exists {
+		return putMissingMappings(ctx, s.Elastic, "nodes", settings)
+	}
+
 	var buf bytes.Buffer
 	if err = json.NewEncoder(&buf).Encode(settings); err != nil {
 		return err
@@ -236,48 +294,79 @@ func (s *DefaultNodeSearch) EnsureIndexNode(ctx context.Context) error {
 	return nil
 }
 
-func buildNodeFilter(filter *searchpb.SearchNodeFilter) []map[string]interface{} {
-	var filters []map[string]interface{}
+type nodeDocument struct {
+	*searchpb.Node
+	Suggest *completionInput `json:"suggest,omitempty"`
+}
 
-	if filter.GetUseIsDelete() {
-		if filter.GetIsDelete() {
-			filters = append(filters, map[string]interface{}{
-				"term": map[string]interface{}{
-					"is_delete": true,
-				},
-			})
-		} else {
-			filters = append(filters, map[string]interface{}{
-				"bool": map[string]interface{}{
-					"must_not": map[string]interface{}{
-						"exists": map[string]interface{}{
-							"field": "is_delete",
-						},
-					},
-				},
-			})
-		}
+func newNodeDocument(node *searchpb.Node) *nodeDocument {
+	return &nodeDocument{
+		Node: node,
+		Suggest: newCompletionInput(node.GetName(), node.GetPopularity(), map[string][]string{
+			"zone": {node.GetZone()},
+			"type": {node.GetType()},
+		}),
 	}
+}
 
-	if filter.GetUseIsPassive() {
-		if filter.GetIsPassive() {
-			filters = append(filters, map[string]interface{}{
-				"term": map[string]interface{}{
-					"is_passive": true,
-				},
-			})
-		} else {
-			filters = append(filters, map[string]interface{}{
-				"bool": map[string]interface{}{
-					"must_not": map[string]interface{}{
-						"exists": map[string]interface{}{
-							"field": "is_passive",
-						},
-					},
-				},
-			})
+func buildNodeBoolQuery(search *searchpb.Search, filter *searchpb.SearchNodeFilter) (map[string]interface{}, error) {
+	must, filters, mustNot, err := nodeQueryLanguage.compile(search.GetQuery())
+	if err != nil {
+		return nil, err
+	}
+
+	boolQuery := map[string]interface{}{
+		"filter": append(buildNodeFilter(filter), filters...),
+	}
+
+	if len(must) > 0 {
+		boolQuery["must"] = must
+	}
+
+	if len(mustNot) > 0 {
+		boolQuery["must_not"] = mustNot
+	}
+
+	if should := buildAdminBoost("address.", filter.GetPreferAdmin()); len(should) > 0 {
+		boolQuery["should"] = should
+	}
+
+	return boolQuery, nil
+}
+
+func buildNodeSearchQuery(search *searchpb.Search, filter *searchpb.SearchNodeFilter) (map[string]interface{}, error) {
+	boolQuery, err := buildNodeBoolQuery(search, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	searchQuery := map[string]interface{}{
+		"from": search.Offset,
+		"size": search.Limit,
+		"query": map[string]interface{}{
+			"bool": boolQuery,
+		},
+	}
+
+	if near := search.GetNear(); near != nil {
+		searchQuery["sort"] = []map[string]interface{}{
+			buildGeoDistanceSort("address.location", near),
+			{"_score": map[string]interface{}{"order": "desc"}},
 		}
 	}
 
+	applySourceFilter(searchQuery, search.GetIncludeSource(), search.GetFields())
+
+	return searchQuery, nil
+}
+
+func buildNodeFilter(filter *searchpb.SearchNodeFilter) []map[string]interface{} {
+	var filters []map[string]interface{}
+
+	filters = appendFlagFilter(filters, "is_delete", resolveFlagFilter(filter.GetIsDeleteFilter(), filter.GetUseIsDelete(), filter.GetIsDelete()))
+	filters = appendFlagFilter(filters, "is_passive", resolveFlagFilter(filter.GetIsPassiveFilter(), filter.GetUseIsPassive(), filter.GetIsPassive()))
+	filters = append(filters, buildGeoFilter("address.location", filter.GetGeo())...)
+	filters = append(filters, buildAdminFilter("address.", filter.GetAdmin())...)
+
 	return filters
 }
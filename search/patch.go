@@ -0,0 +1,140 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"net/http"
+	"search-service/proto/searchpb"
+)
+
+var ErrEmptyPatch = errors.New("patch has no fields to update")
+
+// ErrDocumentNotFound - патч пришёл для сущности, которой ещё нет в индексе. Частичный документ
+// из одних флагов не создаём: поиск выдавал бы его без имени и адреса
+var ErrDocumentNotFound = errors.New("document not found")
+
+// patchDocument обновляет только переданные поля: читает документ и пишет его целиком с версией
+// updated_at патча. _update поднял бы _version только на единицу, и полная запись с updated_at
+// старее патча прошла бы external_gte и затёрла изменённые поля
+func patchDocument(ctx context.Context, es *elasticsearch.Client, index string, id int32, doc map[string]interface{}) error {
+	if len(doc) == 0 {
+		return ErrEmptyPatch
+	}
+
+	res, err := es.Get(
+		index,
+		fmt.Sprint(id),
+		es.Get.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return ErrDocumentNotFound
+	}
+
+	if res.IsError() {
+		return fmt.Errorf("get failed: %s", res.String())
+	}
+
+	var r struct {
+		SeqNo       int                    `json:"_seq_no"`
+		PrimaryTerm int                    `json:"_primary_term"`
+		Source      map[string]interface{} `json:"_source"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return err
+	}
+
+	// Патч старее документа в индексе (запоздал или пришёл повторно) ничего не меняет
+	version, _ := doc["updated_at"].(int64)
+	if stored, ok := r.Source["updated_at"].(float64); ok && version > 0 && int64(stored) > version {
+		versionConflict(index)
+		return nil
+	}
+
+	for field, value := range doc {
+		r.Source[field] = value
+	}
+
+	data, err := json.Marshal(r.Source)
+	if err != nil {
+		return err
+	}
+
+	opts := []func(*esapi.IndexRequest){
+		es.Index.WithDocumentID(fmt.Sprint(id)),
+		es.Index.WithRefresh("true"),
+		es.Index.WithContext(ctx),
+	}
+
+	if version > 0 {
+		indexRes, err := es.Index(index, bytes.NewReader(data), append(opts, indexVersionOptions(es, version)...)...)
+		if err != nil {
+			return err
+		}
+		defer indexRes.Body.Close()
+
+		return checkIndexResponse(indexRes, index)
+	}
+
+	// Без updated_at защищаемся только от записи между чтением и записью. Такой конфликт -
+	// не устаревший патч, а гонка, и патч не должен молча потеряться
+	indexRes, err := es.Index(index, bytes.NewReader(data), append(opts, es.Index.WithIfSeqNo(r.SeqNo), es.Index.WithIfPrimaryTerm(r.PrimaryTerm))...)
+	if err != nil {
+		return err
+	}
+	defer indexRes.Body.Close()
+
+	if indexRes.IsError() {
+		return fmt.Errorf("index failed: %s", indexRes.String())
+	}
+
+	return nil
+}
+
+func buildNodePatch(patch *searchpb.NodePatch) map[string]interface{} {
+	doc := map[string]interface{}{}
+
+	if patch.IsDelete != nil {
+		doc["is_delete"] = patch.GetIsDelete()
+	}
+	if patch.IsPassive != nil {
+		doc["is_passive"] = patch.GetIsPassive()
+	}
+	if patch.Owner != nil {
+		doc["owner"] = patch.GetOwner()
+	}
+
+	// updated_at без изменённых полей - не повод трогать документ
+	if len(doc) > 0 && patch.GetUpdatedAt() > 0 {
+		doc["updated_at"] = patch.GetUpdatedAt()
+	}
+
+	return doc
+}
+
+func buildHardwarePatch(patch *searchpb.HardwarePatch) map[string]interface{} {
+	doc := map[string]interface{}{}
+
+	if patch.IsDelete != nil {
+		doc["is_delete"] = patch.GetIsDelete()
+	}
+	if patch.IpAddress != nil {
+		doc["ip_address"] = patch.GetIpAddress()
+	}
+
+	if len(doc) > 0 && patch.GetUpdatedAt() > 0 {
+		doc["updated_at"] = patch.GetUpdatedAt()
+	}
+
+	return doc
+}
@@ -0,0 +1,197 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeIndex - один индекс ES в памяти с external_gte и if_seq_no, как их проверяет ES
+type fakeIndex struct {
+	mu   sync.Mutex
+	docs map[string]*fakeDocument
+	seq  int
+}
+
+type fakeDocument struct {
+	version int64
+	seqNo   int
+	source  json.RawMessage
+}
+
+func newFakeElastic(t *testing.T) (*elasticsearch.Client, *fakeIndex) {
+	t.Helper()
+
+	index := &fakeIndex{docs: map[string]*fakeDocument{}}
+	server := httptest.NewServer(index)
+	t.Cleanup(server.Close)
+
+	es, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return es, index
+}
+
+func (f *fakeIndex) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.Header().Set("Content-Type", "application/json")
+
+	// /{index}/_doc/{id}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 || parts[1] != "_doc" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	id := parts[2]
+	doc := f.docs[id]
+
+	if r.Method == http.MethodGet {
+		if doc == nil {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"found":false}`)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"_id":           id,
+			"_version":      doc.version,
+			"_seq_no":       doc.seqNo,
+			"_primary_term": 1,
+			"found":         true,
+			"_source":       doc.source,
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	version := int64(1)
+	if doc != nil {
+		version = doc.version + 1
+	}
+
+	if v := query.Get("version"); v != "" {
+		version, _ = strconv.ParseInt(v, 10, 64)
+		if doc != nil && version < doc.version {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = io.WriteString(w, `{"error":{"type":"version_conflict_engine_exception"},"status":409}`)
+			return
+		}
+	}
+
+	if s := query.Get("if_seq_no"); s != "" {
+		seqNo, _ := strconv.Atoi(s)
+		if doc == nil || doc.seqNo != seqNo {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = io.WriteString(w, `{"error":{"type":"version_conflict_engine_exception"},"status":409}`)
+			return
+		}
+	}
+
+	f.seq++
+	f.docs[id] = &fakeDocument{version: version, seqNo: f.seq, source: body}
+
+	_, _ = io.WriteString(w, `{"result":"updated"}`)
+}
+
+func (f *fakeIndex) source(t *testing.T, id string) map[string]interface{} {
+	t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var source map[string]interface{}
+	if err := json.Unmarshal(f.docs[id].source, &source); err != nil {
+		t.Fatal(err)
+	}
+
+	return source
+}
+
+func indexFullNode(t *testing.T, es *elasticsearch.Client, doc map[string]interface{}, version int64) {
+	t.Helper()
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := es.Index("nodes", bytes.NewReader(data), append([]func(*esapi.IndexRequest){
+		es.Index.WithDocumentID("1"),
+	}, indexVersionOptions(es, version)...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if err = checkIndexResponse(res, "nodes"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPatchThenOlderFullIndex(t *testing.T) {
+	es, index := newFakeElastic(t)
+	ctx := context.Background()
+
+	indexFullNode(t, es, map[string]interface{}{"name": "Узел", "is_passive": false, "updated_at": 100}, 100)
+
+	if err := patchDocument(ctx, es, "nodes", 1, map[string]interface{}{"is_passive": true, "updated_at": int64(300)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Полная запись, сделанная в источнике раньше патча, пришла позже него
+	indexFullNode(t, es, map[string]interface{}{"name": "Узел", "is_passive": false, "updated_at": 200}, 200)
+
+	source := index.source(t, "1")
+	if source["is_passive"] != true || source["updated_at"] != float64(300) {
+		t.Errorf("older full index overwrote the patch: %v", source)
+	}
+
+	if source["name"] != "Узел" {
+		t.Errorf("patch lost unchanged fields: %v", source)
+	}
+}
+
+func TestPatchOlderThanDocument(t *testing.T) {
+	es, index := newFakeElastic(t)
+
+	indexFullNode(t, es, map[string]interface{}{"name": "Узел", "is_passive": false, "updated_at": 300}, 300)
+
+	if err := patchDocument(context.Background(), es, "nodes", 1, map[string]interface{}{"is_passive": true, "updated_at": int64(200)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if source := index.source(t, "1"); source["is_passive"] != false {
+		t.Errorf("stale patch was applied: %v", source)
+	}
+}
+
+func TestPatchUnknownDocument(t *testing.T) {
+	es, index := newFakeElastic(t)
+
+	err := patchDocument(context.Background(), es, "nodes", 1, map[string]interface{}{"is_passive": true, "updated_at": int64(200)})
+	if !errors.Is(err, ErrDocumentNotFound) {
+		t.Fatalf("err = %v, want ErrDocumentNotFound", err)
+	}
+
+	if len(index.docs) != 0 {
+		t.Errorf("patch created a partial document")
+	}
+}
@@ -0,0 +1,543 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Язык запросов для узлов и оборудования:
+//
+//	zone:north type:switch -passive "Ленина 12" (owner:ivanov OR owner:petrov)
+//
+// Слова без поля ищутся как раньше одним multi_match, поле:значение и флаги (is:passive, -passive) уходят в filter,
+// отрицание - в must_not, группы с OR - в should. Запрос без синтаксиса компилируется ровно в прежний multi_match
+
+type QuerySyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("query syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+func syntaxError(pos int, format string, args ...interface{}) error {
+	return &QuerySyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+type queryField struct {
+	path    string
+	keyword bool
+}
+
+type queryLanguage struct {
+	textFields   []string
+	phraseFields []string
+	fields       map[string]queryField
+	flags        map[string]string
+}
+
+var nodeQueryLanguage = &queryLanguage{
+	textFields:   []string{"name.edge", "zone.edge", "owner.edge", "address.street_name.edge", "address.street_type.edge", "address.house_name.edge", "address.house_type.edge", "type.edge"},
+	phraseFields: []string{"name", "zone", "owner", "address.street_name", "address.house_name", "type"},
+	fields: map[string]queryField{
+		"name":     {path: "name"},
+		"zone":     {path: "zone"},
+		"owner":    {path: "owner"},
+		"type":     {path: "type"},
+		"street":   {path: "address.street_name"},
+		"house":    {path: "address.house_name"},
+		"region":   {path: "address.region", keyword: true},
+		"district": {path: "address.district", keyword: true},
+		"locality": {path: "address.locality", keyword: true},
+	},
+	flags: map[string]string{
+		"passive": "is_passive",
+		"deleted": "is_delete",
+	},
+}
+
+var hardwareQueryLanguage = &queryLanguage{
+	textFields:   []string{"type.edge", "node_name.edge", "model_name.edge", "ip_address.edge", "address.street_name.edge", "address.street_type.edge", "address.house_name.edge", "address.house_type.edge"},
+	phraseFields: []string{"type", "node_name", "model_name", "ip_address", "address.street_name", "address.house_name"},
+	fields: map[string]queryField{
+		"type":     {path: "type"},
+		"node":     {path: "node_name"},
+		"model":    {path: "model_name"},
+		"ip":       {path: "ip_address"},
+		"street":   {path: "address.street_name"},
+		"house":    {path: "address.house_name"},
+		"region":   {path: "address.region", keyword: true},
+		"district": {path: "address.district", keyword: true},
+		"locality": {path: "address.locality", keyword: true},
+	},
+	flags: map[string]string{
+		"deleted": "is_delete",
+	},
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenPhrase
+	tokenOpen
+	tokenClose
+	tokenNot
+	tokenOr
+)
+
+type queryToken struct {
+	kind  tokenKind
+	text  string
+	field string
+	pos   int
+}
+
+type queryNode interface{}
+
+type termNode struct {
+	field  string
+	value  string
+	phrase bool
+}
+
+type flagNode struct {
+	field string
+}
+
+type notNode struct {
+	child queryNode
+}
+
+type andNode []queryNode
+
+type orNode []queryNode
+
+// Префикс до двоеточия считается полем, только если это известное поле или is:
+// так MAC (aa:bb:cc:dd:ee:ff), IPv6 и "10:30" остаются текстом
+func (l *queryLanguage) splitField(word string) (string, string, bool) {
+	colon := strings.IndexRune(word, ':')
+	if colon <= 0 {
+		return "", "", false
+	}
+
+	field := strings.ToLower(word[:colon])
+	if _, ok := l.fields[field]; !ok && field != "is" {
+		return "", "", false
+	}
+
+	return field, word[colon+1:], true
+}
+
+// Позиции в ошибках - номер символа с единицы
+func (l *queryLanguage) tokenize(text string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokenOpen, pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokenClose, pos: pos})
+			i++
+		case r == '-' && (i == 0 || unicode.IsSpace(runes[i-1]) || runes[i-1] == '('):
+			if i+1 >= len(runes) || unicode.IsSpace(runes[i+1]) || runes[i+1] == ')' {
+				return nil, syntaxError(pos, "nothing to negate")
+			}
+			tokens = append(tokens, queryToken{kind: tokenNot, pos: pos})
+			i++
+		case r == '"':
+			phrase, next, err := readPhrase(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: tokenPhrase, text: phrase, pos: pos})
+			i = next
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != '"' {
+				i++
+			}
+			word := string(runes[start:i])
+
+			if word == "OR" {
+				tokens = append(tokens, queryToken{kind: tokenOr, pos: pos})
+				continue
+			}
+
+			token := queryToken{kind: tokenWord, text: word, pos: pos}
+
+			if field, value, ok := l.splitField(word); ok {
+				token.field, token.text = field, value
+
+				// поле:"фраза"
+				if token.text == "" && i < len(runes) && runes[i] == '"' {
+					phrase, next, err := readPhrase(runes, i)
+					if err != nil {
+						return nil, err
+					}
+					token.kind, token.text = tokenPhrase, phrase
+					i = next
+				}
+
+				if token.text == "" {
+					return nil, syntaxError(pos, "empty value for field %q", field)
+				}
+			}
+
+			tokens = append(tokens, token)
+		}
+	}
+
+	return tokens, nil
+}
+
+func readPhrase(runes []rune, start int) (string, int, error) {
+	end := start + 1
+	for end < len(runes) && runes[end] != '"' {
+		end++
+	}
+
+	if end >= len(runes) {
+		return "", 0, syntaxError(start+1, "unclosed quote")
+	}
+
+	phrase := strings.TrimSpace(string(runes[start+1 : end]))
+	if phrase == "" {
+		return "", 0, syntaxError(start+1, "empty phrase")
+	}
+
+	return phrase, end + 1, nil
+}
+
+type queryParser struct {
+	lang   *queryLanguage
+	tokens []queryToken
+	pos    int
+}
+
+func (l *queryLanguage) parse(text string) (queryNode, error) {
+	tokens, err := l.tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{lang: l, tokens: tokens}
+
+	return p.parseExpr(false)
+}
+
+// expr := and ("OR" and)*; and := unary+
+func (p *queryParser) parseExpr(nested bool) (queryNode, error) {
+	var alternatives orNode
+	var current andNode
+
+	for p.pos < len(p.tokens) {
+		token := p.tokens[p.pos]
+
+		if token.kind == tokenClose {
+			if !nested {
+				return nil, syntaxError(token.pos, "unexpected )")
+			}
+			break
+		}
+
+		if token.kind == tokenOr {
+			if len(current) == 0 {
+				return nil, syntaxError(token.pos, "OR without left operand")
+			}
+
+			p.pos++
+			if p.pos >= len(p.tokens) || p.tokens[p.pos].kind == tokenClose || p.tokens[p.pos].kind == tokenOr {
+				return nil, syntaxError(token.pos, "OR without right operand")
+			}
+
+			alternatives = append(alternatives, current)
+			current = nil
+			continue
+		}
+
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		current = append(current, node)
+	}
+
+	if len(alternatives) == 0 {
+		return current, nil
+	}
+
+	return append(alternatives, current), nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	token := p.tokens[p.pos]
+	if token.kind != tokenNot {
+		return p.parsePrimary()
+	}
+
+	p.pos++
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind == tokenClose || p.tokens[p.pos].kind == tokenOr {
+		return nil, syntaxError(token.pos, "nothing to negate")
+	}
+
+	child, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	// -passive - то же, что -is:passive; без минуса слово флага остаётся текстом
+	if term, ok := child.(termNode); ok && term.field == "" && !term.phrase {
+		if field, ok := p.lang.flags[strings.ToLower(term.value)]; ok {
+			child = flagNode{field: field}
+		}
+	}
+
+	return notNode{child: child}, nil
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	token := p.tokens[p.pos]
+	p.pos++
+
+	switch token.kind {
+	case tokenOpen:
+		node, err := p.parseExpr(true)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.pos >= len(p.tokens) {
+			return nil, syntaxError(token.pos, "unclosed (")
+		}
+		p.pos++
+
+		if and, ok := node.(andNode); ok && len(and) == 0 {
+			return nil, syntaxError(token.pos, "empty group")
+		}
+
+		return node, nil
+	case tokenWord, tokenPhrase:
+		return p.lang.term(token)
+	default:
+		return nil, syntaxError(token.pos, "unexpected token")
+	}
+}
+
+func (l *queryLanguage) term(token queryToken) (queryNode, error) {
+	phrase := token.kind == tokenPhrase
+
+	if token.field == "is" {
+		field, ok := l.flags[strings.ToLower(token.text)]
+		if !ok {
+			return nil, syntaxError(token.pos, "unknown flag %q", token.text)
+		}
+
+		return flagNode{field: field}, nil
+	}
+
+	return termNode{field: token.field, value: token.text, phrase: phrase}, nil
+}
+
+func (l *queryLanguage) clause(node queryNode) map[string]interface{} {
+	switch n := node.(type) {
+	case flagNode:
+		return map[string]interface{}{
+			"term": map[string]interface{}{n.field: true},
+		}
+	case termNode:
+		return l.termClause(n)
+	case notNode:
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": []map[string]interface{}{l.clause(n.child)},
+			},
+		}
+	case orNode:
+		var should []map[string]interface{}
+		for _, child := range n {
+			should = append(should, l.clause(child))
+		}
+
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should":               should,
+				"minimum_should_match": 1,
+			},
+		}
+	case andNode:
+		if len(n) == 1 {
+			return l.clause(n[0])
+		}
+
+		must, filter, mustNot := l.compileAnd(n)
+
+		query := map[string]interface{}{}
+		if len(must) > 0 {
+			query["must"] = must
+		}
+		if len(filter) > 0 {
+			query["filter"] = filter
+		}
+		if len(mustNot) > 0 {
+			query["must_not"] = mustNot
+		}
+
+		return map[string]interface{}{"bool": query}
+	default:
+		return nil
+	}
+}
+
+func (l *queryLanguage) termClause(n termNode) map[string]interface{} {
+	if n.field == "" {
+		if n.phrase {
+			return map[string]interface{}{
+				"multi_match": map[string]interface{}{
+					"query":  n.value,
+					"type":   "phrase",
+					"fields": l.phraseFields,
+				},
+			}
+		}
+
+		return map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":  n.value,
+				"fields": l.textFields,
+			},
+		}
+	}
+
+	field := l.fields[n.field]
+
+	switch {
+	case field.keyword:
+		return map[string]interface{}{
+			"term": map[string]interface{}{field.path: n.value},
+		}
+	case n.phrase:
+		return map[string]interface{}{
+			"match_phrase": map[string]interface{}{field.path: n.value},
+		}
+	default:
+		return map[string]interface{}{
+			"match": map[string]interface{}{
+				field.path + ".edge": map[string]interface{}{
+					"query":    n.value,
+					"operator": "and",
+				},
+			},
+		}
+	}
+}
+
+// Свободные слова собираются в один multi_match - так же, как раньше искался весь запрос
+func (l *queryLanguage) compileAnd(nodes andNode) (must, filter, mustNot []map[string]interface{}) {
+	var words []string
+
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case termNode:
+			if n.field == "" && !n.phrase {
+				words = append(words, n.value)
+			} else if n.field == "" {
+				must = append(must, l.termClause(n))
+			} else {
+				filter = append(filter, l.termClause(n))
+			}
+		case flagNode:
+			filter = append(filter, l.clause(n))
+		case notNode:
+			mustNot = append(mustNot, l.clause(n.child))
+		default:
+			must = append(must, l.clause(n))
+		}
+	}
+
+	if len(words) > 0 {
+		must = append([]map[string]interface{}{
+			l.termClause(termNode{value: strings.Join(words, " ")}),
+		}, must...)
+	}
+
+	return must, filter, mustNot
+}
+
+// parseQuery разбирает запрос; plain - в запросе нет синтаксиса. Незакрытая кавычка или скобка
+// в запросе без операторов (ТЦ "Мега, корп 2 (стр) - часть текста, а не ошибка
+func (l *queryLanguage) parseQuery(text string) (node queryNode, plain bool, err error) {
+	node, err = l.parse(text)
+	if err == nil {
+		return node, isPlainNode(node), nil
+	}
+
+	stripped := strings.Map(func(r rune) rune {
+		if r == '"' || r == '(' || r == ')' {
+			return ' '
+		}
+		return r
+	}, text)
+
+	if strippedNode, strippedErr := l.parse(stripped); strippedErr == nil && isPlainNode(strippedNode) {
+		return nil, true, nil
+	}
+
+	return nil, false, err
+}
+
+// compile разбирает запрос и раскладывает его по частям bool-запроса
+func (l *queryLanguage) compile(text string) (must, filter, mustNot []map[string]interface{}, err error) {
+	node, plain, err := l.parseQuery(text)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Обычный текст (и пустой запрос) уходит в multi_match без изменений, как раньше
+	if plain {
+		return []map[string]interface{}{l.termClause(termNode{value: text})}, nil, nil, nil
+	}
+
+	switch n := node.(type) {
+	case andNode:
+		must, filter, mustNot = l.compileAnd(n)
+	default:
+		must = []map[string]interface{}{l.clause(n)}
+	}
+
+	return must, filter, mustNot, nil
+}
+
+// isPlainQuery: в запросе нет синтаксиса, его можно исправлять опечаточником как обычный текст
+func (l *queryLanguage) isPlainQuery(text string) bool {
+	_, plain, err := l.parseQuery(text)
+
+	return err == nil && plain
+}
+
+func isPlainNode(node queryNode) bool {
+	and, ok := node.(andNode)
+	if !ok {
+		return false
+	}
+
+	for _, child := range and {
+		term, ok := child.(termNode)
+		if !ok || term.field != "" || term.phrase {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,119 @@
+package search
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCompileQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		lang  *queryLanguage
+		query string
+		want  string
+	}{
+		{
+			name:  "mac address is plain text",
+			lang:  hardwareQueryLanguage,
+			query: "aa:bb:cc:dd:ee:ff",
+			want:  `{"must":[{"multi_match":{"fields":["type.edge","node_name.edge","model_name.edge","ip_address.edge","address.street_name.edge","address.street_type.edge","address.house_name.edge","address.house_type.edge"],"query":"aa:bb:cc:dd:ee:ff"}}]}`,
+		},
+		{
+			name:  "bare flag word is plain text",
+			lang:  nodeQueryLanguage,
+			query: "passive",
+			want:  `{"must":[{"multi_match":{"fields":["name.edge","zone.edge","owner.edge","address.street_name.edge","address.street_type.edge","address.house_name.edge","address.house_type.edge","type.edge"],"query":"passive"}}]}`,
+		},
+		{
+			name:  "explicit flag",
+			lang:  nodeQueryLanguage,
+			query: "-is:passive zone:north",
+			want:  `{"filter":[{"match":{"zone.edge":{"operator":"and","query":"north"}}}],"must_not":[{"term":{"is_passive":true}}]}`,
+		},
+		{
+			name:  "negated flag word",
+			lang:  nodeQueryLanguage,
+			query: "-passive zone:north",
+			want:  `{"filter":[{"match":{"zone.edge":{"operator":"and","query":"north"}}}],"must_not":[{"term":{"is_passive":true}}]}`,
+		},
+		{
+			name:  "negated word that is not a flag",
+			lang:  hardwareQueryLanguage,
+			query: "-passive",
+			want:  `{"must_not":[{"multi_match":{"fields":["type.edge","node_name.edge","model_name.edge","ip_address.edge","address.street_name.edge","address.street_type.edge","address.house_name.edge","address.house_type.edge"],"query":"passive"}}]}`,
+		},
+		{
+			name:  "unclosed quote in plain text",
+			lang:  nodeQueryLanguage,
+			query: `ТЦ "Мега`,
+			want:  `{"must":[{"multi_match":{"fields":["name.edge","zone.edge","owner.edge","address.street_name.edge","address.street_type.edge","address.house_name.edge","address.house_type.edge","type.edge"],"query":"ТЦ \"Мега"}}]}`,
+		},
+		{
+			name:  "unclosed paren in plain text",
+			lang:  nodeQueryLanguage,
+			query: "корп 2 (стр",
+			want:  `{"must":[{"multi_match":{"fields":["name.edge","zone.edge","owner.edge","address.street_name.edge","address.street_type.edge","address.house_name.edge","address.house_type.edge","type.edge"],"query":"корп 2 (стр"}}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			must, filter, mustNot, err := tt.lang.compile(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query := map[string]interface{}{}
+			if len(must) > 0 {
+				query["must"] = must
+			}
+			if len(filter) > 0 {
+				query["filter"] = filter
+			}
+			if len(mustNot) > 0 {
+				query["must_not"] = mustNot
+			}
+
+			data, err := json.Marshal(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != tt.want {
+				t.Errorf("got %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileQueryUnknownFlag(t *testing.T) {
+	if _, _, _, err := nodeQueryLanguage.compile("is:broken"); err == nil {
+		t.Error("expected an error for an unknown flag")
+	}
+}
+
+func TestCompileQueryUnbalancedWithOperators(t *testing.T) {
+	for _, query := range []string{`zone:north "Мега`, `(zone:north OR zone:south`, `-passive "Мега`} {
+		if _, _, _, err := nodeQueryLanguage.compile(query); err == nil {
+			t.Errorf("%s: expected a syntax error", query)
+		}
+	}
+}
+
+func TestIsPlainQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"Ленина 12", true},
+		{`ТЦ "Мега`, true},
+		{"-passive", false},
+		{`"Ленина 12"`, false},
+	}
+
+	for _, tt := range tests {
+		if got := nodeQueryLanguage.isPlainQuery(tt.query); got != tt.want {
+			t.Errorf("isPlainQuery(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"net/http"
+	"search-service/proto/searchpb"
+	"sort"
+	"strings"
+)
+
+const (
+	reconcileDeleteChunk = 1000
+	maxDeleteErrors      = 5
+	// Без force удаляется не больше этого числа и не больше этой доли документов индекса:
+	// больше похоже на обрезанный эталонный список, чем на реальные удаления
+	maxReconcileDeletes     = 1000
+	maxReconcileDeleteRatio = 0.1
+)
+
+// ErrUnsafeReconcile - fix отклонён, чтобы не удалить большую часть индекса по неполному списку
+var ErrUnsafeReconcile = errors.New("unsafe reconcile fix")
+
+// Время последнего изменения сущности в источнике, unix-миллисекунды
+var updatedAtMapping = map[string]interface{}{
+	"type":   "date",
+	"format": "epoch_millis",
+}
+
+type Reconciler interface {
+	Reconcile(ctx context.Context, entity searchpb.Entity, source map[int32]int64, fix, force bool) (*ReconcileReport, error)
+}
+
+// Resender просит источник данных заново прислать сущности
+type Resender interface {
+	RequestResend(ctx context.Context, entity searchpb.Entity, ids []int32) error
+}
+
+type DefaultReconciler struct {
+	Elastic  *elasticsearch.Client
+	Resender Resender
+	Cache    *SearchCache
+}
+
+type ReconcileReport struct {
+	Missing         []int32
+	Extra           []int32
+	Stale           []int32
+	Deleted         int32
+	ResendRequested int32
+}
+
+func EntityIndex(entity searchpb.Entity) (string, error) {
+	switch entity {
+	case searchpb.Entity_ENTITY_NODE:
+		return "nodes", nil
+	case searchpb.Entity_ENTITY_HARDWARE:
+		return "hardware", nil
+	case searchpb.Entity_ENTITY_ADDRESS:
+		return "addresses", nil
+	default:
+		return "", fmt.Errorf("unsupported entity %v", entity)
+	}
+}
+
+// Reconcile сравнивает индекс с эталонным набором id -> updated_at. С fix лишние документы удаляются,
+// а отсутствующие и устаревшие запрашиваются у источника повторно. С пустым набором fix не выполняется,
+// а слишком много удалений требует force
+func (r *DefaultReconciler) Reconcile(ctx context.Context, entity searchpb.Entity, source map[int32]int64, fix, force bool) (*ReconcileReport, error) {
+	index, err := EntityIndex(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	if fix && len(source) == 0 {
+		return nil, fmt.Errorf("%w: source id list is empty", ErrUnsafeReconcile)
+	}
+
+	report, err := reconcileIndex(ctx, r.Elastic, index, source)
+	if err != nil || !fix {
+		return report, err
+	}
+
+	if err = checkReconcileDeletes(report, len(source), force); err != nil {
+		return report, err
+	}
+
+	report.Deleted, err = deleteDocuments(ctx, r.Elastic, index, report.Extra)
+	r.Cache.Invalidate(index)
+	if err != nil {
+		return report, err
+	}
+
+	resend := append(append([]int32{}, report.Missing...), report.Stale...)
+	if r.Resender != nil && len(resend) > 0 {
+		if err = r.Resender.RequestResend(ctx, entity, resend); err != nil {
+			return report, err
+		}
+
+		report.ResendRequested = int32(len(resend))
+	}
+
+	return report, nil
+}
+
+// Документ устарел, если в источнике он изменён позже, чем записан в индексе;
+// нулевой updated_at в источнике означает "не проверять"
+func reconcileIndex(ctx context.Context, es *elasticsearch.Client, index string, source map[int32]int64) (*ReconcileReport, error) {
+	report := &ReconcileReport{}
+	seen := make(map[int32]struct{}, len(source))
+
+	searchQuery := map[string]interface{}{
+		"query": map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		},
+		"sort": []map[string]interface{}{
+			{"_shard_doc": "asc"},
+		},
+		"_source": map[string]interface{}{
+			"includes": []string{"updated_at"},
+		},
+	}
+
+	err := exportIndex(ctx, es, index, searchQuery, maxExportBatchSize, func(result *SearchResult) error {
+		for i, id := range result.IDs {
+			updatedAt, ok := source[id]
+			if !ok {
+				report.Extra = append(report.Extra, id)
+				continue
+			}
+
+			seen[id] = struct{}{}
+
+			if updatedAt == 0 {
+				continue
+			}
+
+			var doc struct {
+				UpdatedAt int64 `json:"updated_at"`
+			}
+
+			if len(result.Sources[i]) > 0 {
+				if err := json.Unmarshal(result.Sources[i], &doc); err != nil {
+					return err
+				}
+			}
+
+			if doc.UpdatedAt < updatedAt {
+				report.Stale = append(report.Stale, id)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for id := range source {
+		if _, ok := seen[id]; !ok {
+			report.Missing = append(report.Missing, id)
+		}
+	}
+
+	for _, ids := range [][]int32{report.Missing, report.Extra, report.Stale} {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+
+	return report, nil
+}
+
+func checkReconcileDeletes(report *ReconcileReport, sourceSize int, force bool) error {
+	if force || len(report.Extra) == 0 {
+		return nil
+	}
+
+	indexed := sourceSize - len(report.Missing) + len(report.Extra)
+	ratio := float64(len(report.Extra)) / float64(indexed)
+
+	if len(report.Extra) > maxReconcileDeletes || ratio > maxReconcileDeleteRatio {
+		return fmt.Errorf("%w: %d of %d documents in the index would be deleted, use force to confirm", ErrUnsafeReconcile, len(report.Extra), indexed)
+	}
+
+	return nil
+}
+
+// 404 считается удалённым: документа уже нет, что и требовалось
+func deleteDocuments(ctx context.Context, es *elasticsearch.Client, index string, ids []int32) (int32, error) {
+	var deleted int32
+	var failed []string
+
+	for start := 0; start < len(ids); start += reconcileDeleteChunk {
+		end := start + reconcileDeleteChunk
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		var buf bytes.Buffer
+		for _, id := range ids[start:end] {
+			buf.WriteString(fmt.Sprintf(`{ "delete" : { "_id" : "%d" } }%s`, id, "\n"))
+		}
+
+		res, err := es.Bulk(
+			bytes.NewReader(buf.Bytes()),
+			es.Bulk.WithIndex(index),
+			es.Bulk.WithRefresh("true"),
+			es.Bulk.WithContext(ctx),
+		)
+		if err != nil {
+			return deleted, err
+		}
+
+		n, errs, err := decodeDeleteResponse(res)
+		res.Body.Close()
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+
+		failed = append(failed, errs...)
+	}
+
+	if len(failed) > 0 {
+		// В ошибку попадают только первые элементы, остальные одинаковы по смыслу
+		return deleted, fmt.Errorf("failed to delete %d documents from %s: %s", len(failed), index, strings.Join(failed[:min(len(failed), maxDeleteErrors)], "; "))
+	}
+
+	return deleted, nil
+}
+
+func decodeDeleteResponse(res *esapi.Response) (int32, []string, error) {
+	if res.IsError() {
+		return 0, nil, fmt.Errorf("bulk delete failed: %s", res.String())
+	}
+
+	var bulkResp struct {
+		Items []map[string]struct {
+			ID     string          `json:"_id"`
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&bulkResp); err != nil {
+		return 0, nil, err
+	}
+
+	var deleted int32
+	var failed []string
+
+	for _, item := range bulkResp.Items {
+		result := item["delete"]
+
+		switch result.Status {
+		case http.StatusOK, http.StatusNotFound:
+			deleted++
+		default:
+			failed = append(failed, fmt.Sprintf("id=%s status=%d %s", result.ID, result.Status, result.Error))
+		}
+	}
+
+	return deleted, failed, nil
+}
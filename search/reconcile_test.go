@@ -0,0 +1,42 @@
+package search
+
+import (
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeDeleteResponse(t *testing.T) {
+	body := `{"errors": true, "items": [
+		{"delete": {"_id": "1", "status": 200}},
+		{"delete": {"_id": "2", "status": 404}},
+		{"delete": {"_id": "3", "status": 429, "error": {"type": "es_rejected_execution_exception"}}}
+	]}`
+
+	res := &esapi.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(body))}
+
+	deleted, failed, err := decodeDeleteResponse(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Уже отсутствующий документ считается удалённым
+	if deleted != 2 {
+		t.Errorf("deleted = %d, want 2", deleted)
+	}
+
+	want := []string{`id=3 status=429 {"type": "es_rejected_execution_exception"}`}
+	if !reflect.DeepEqual(failed, want) {
+		t.Errorf("failed = %q, want %q", failed, want)
+	}
+}
+
+func TestDecodeDeleteResponseRequestError(t *testing.T) {
+	res := &esapi.Response{StatusCode: 400, Body: io.NopCloser(strings.NewReader(`{"error": "bad request"}`))}
+
+	if _, _, err := decodeDeleteResponse(res); err == nil {
+		t.Error("expected error for failed bulk request")
+	}
+}
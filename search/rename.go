@@ -0,0 +1,224 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"os"
+	"search-service/proto/searchpb"
+	"strconv"
+	"sync"
+)
+
+// Оборудование с актуальным именем узла не перезаписываем
+const renameNodeScript = `
+def name = params.names[String.valueOf(ctx._source.node_id)];
+if (name == null || ctx._source.node_name == name) {
+	ctx.op = 'noop';
+} else {
+	ctx._source.node_name = name;
+}`
+
+// Сколько узлов переименовывается одним _update_by_query: terms ограничен index.max_terms_count
+const renameChunk = 10000
+
+// RenamePropagationDisabled: NODE_RENAME_PROPAGATION=off отключает обновление node_name в hardware,
+// например на время массовой загрузки, когда hardware всё равно будет переиндексировано
+func RenamePropagationDisabled() bool {
+	return os.Getenv("NODE_RENAME_PROPAGATION") == "off"
+}
+
+type storedNode struct {
+	Name      string `json:"name"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// storedNodes возвращает имена узлов в том виде, в каком они сейчас лежат в индексе
+func storedNodes(ctx context.Context, es *elasticsearch.Client, ids []int32) (map[int32]storedNode, error) {
+	names := make(map[int32]storedNode, len(ids))
+	if len(ids) == 0 {
+		return names, nil
+	}
+
+	docIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		docIDs = append(docIDs, fmt.Sprint(id))
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"ids": docIDs})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := es.Mget(
+		bytes.NewReader(data),
+		es.Mget.WithIndex("nodes"),
+		es.Mget.WithSourceIncludes("name", "updated_at"),
+		es.Mget.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	// Индекса ещё нет - переименовывать нечего
+	if res.StatusCode == 404 {
+		return names, nil
+	}
+
+	if res.IsError() {
+		return nil, fmt.Errorf("mget failed: %s", res.String())
+	}
+
+	var r struct {
+		Docs []struct {
+			ID     string     `json:"_id"`
+			Found  bool       `json:"found"`
+			Source storedNode `json:"_source"`
+		} `json:"docs"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	for _, doc := range r.Docs {
+		if !doc.Found {
+			continue
+		}
+
+		id, err := strconv.Atoi(doc.ID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %s: %v", doc.ID, err)
+		}
+
+		names[int32(id)] = doc.Source
+	}
+
+	return names, nil
+}
+
+// propagateNodeRenames обновляет node_name у оборудования узлов, чьё имя отличается от сохранённого.
+// Новые узлы (их нет в stored) пропускаются - у их оборудования имя и так актуально.
+// Устаревшие версии тоже: индекс их не принял, значит и имя не менялось
+func propagateNodeRenames(ctx context.Context, es *elasticsearch.Client, cache *SearchCache, stored map[int32]storedNode, nodes []*searchpb.Node) error {
+	names := map[string]string{}
+
+	for _, node := range nodes {
+		old, ok := stored[node.GetId()]
+		if !ok || old.Name == node.GetName() {
+			continue
+		}
+
+		if node.GetUpdatedAt() > 0 && node.GetUpdatedAt() < old.UpdatedAt {
+			continue
+		}
+
+		names[fmt.Sprint(node.GetId())] = node.GetName()
+	}
+
+	return renameHardwareNodes(ctx, es, cache, names)
+}
+
+// renameHardwareNodes проставляет node_name оборудованию узлов из names (id узла -> новое имя)
+func renameHardwareNodes(ctx context.Context, es *elasticsearch.Client, cache *SearchCache, names map[string]string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	nodeIDs := make([]string, 0, len(names))
+	for id := range names {
+		nodeIDs = append(nodeIDs, id)
+	}
+
+	for start := 0; start < len(nodeIDs); start += renameChunk {
+		end := min(start+renameChunk, len(nodeIDs))
+
+		chunk := make(map[string]string, end-start)
+		for _, id := range nodeIDs[start:end] {
+			chunk[id] = names[id]
+		}
+
+		if err := renameHardwareNodesChunk(ctx, es, cache, nodeIDs[start:end], chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func renameHardwareNodesChunk(ctx context.Context, es *elasticsearch.Client, cache *SearchCache, nodeIDs []string, names map[string]string) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"query": map[string]interface{}{
+			"terms": map[string]interface{}{
+				"node_id": nodeIDs,
+			},
+		},
+		"script": map[string]interface{}{
+			"lang":   "painless",
+			"source": renameNodeScript,
+			"params": map[string]interface{}{
+				"names": names,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	res, err := es.UpdateByQuery(
+		[]string{"hardware"},
+		es.UpdateByQuery.WithBody(bytes.NewReader(data)),
+		es.UpdateByQuery.WithConflicts("proceed"),
+		es.UpdateByQuery.WithRefresh(true),
+		es.UpdateByQuery.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	cache.Invalidate("hardware")
+
+	if res.IsError() {
+		return fmt.Errorf("node rename propagation failed: %s", res.String())
+	}
+
+	var r struct {
+		Failures []json.RawMessage `json:"failures"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return err
+	}
+
+	if len(r.Failures) > 0 {
+		return fmt.Errorf("node rename propagation had %d failures", len(r.Failures))
+	}
+
+	return nil
+}
+
+// streamRenames собирает имена узлов, записанных потоковой загрузкой. Прежние имена при этом
+// не читаются: на Close оборудованию всех записанных узлов проставляется текущее имя,
+// а где оно уже такое же, скрипт ничего не меняет
+type streamRenames struct {
+	mu    sync.Mutex
+	names map[string]string
+}
+
+func (r *streamRenames) add(node *searchpb.Node) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.names[fmt.Sprint(node.GetId())] = node.GetName()
+}
+
+func (r *streamRenames) propagate(ctx context.Context, es *elasticsearch.Client, cache *SearchCache) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return renameHardwareNodes(ctx, es, cache, r.names)
+}
@@ -0,0 +1,110 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"search-service/proto/searchpb"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Потоковая загрузка узлов переименовывает оборудование только тех узлов, которые записаны
+func TestNodeIndexerPropagatesRenames(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		renames map[string]string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_bulk"):
+			// Узел 2 устарел по версии и не записан
+			var items []string
+			scanner := bufio.NewScanner(r.Body)
+			for scanner.Scan() {
+				var meta map[string]struct {
+					ID string `json:"_id"`
+				}
+				if err := json.Unmarshal(scanner.Bytes(), &meta); err != nil || meta["index"].ID == "" {
+					continue
+				}
+
+				status := http.StatusCreated
+				if meta["index"].ID == "2" {
+					status = http.StatusConflict
+				}
+
+				items = append(items, fmt.Sprintf(`{"index":{"_index":"nodes","_id":%q,"status":%d}}`, meta["index"].ID, status))
+			}
+
+			fmt.Fprintf(w, `{"errors":true,"items":[%s]}`, strings.Join(items, ","))
+		case strings.HasSuffix(r.URL.Path, "/_update_by_query"):
+			var body struct {
+				Script struct {
+					Params struct {
+						Names map[string]string `json:"names"`
+					} `json:"params"`
+				} `json:"script"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+
+			mu.Lock()
+			renames = body.Script.Params.Names
+			mu.Unlock()
+
+			_, _ = io.WriteString(w, `{"failures":[]}`)
+		default:
+			_, _ = io.WriteString(w, `{}`)
+		}
+	}))
+	defer server.Close()
+
+	es, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &DefaultNodeSearch{Elastic: es}
+
+	indexer, err := s.NewNodeIndexer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, node := range []*searchpb.Node{
+		{Id: 1, Name: "Узел 1", UpdatedAt: 200},
+		{Id: 2, Name: "Узел 2", UpdatedAt: 100},
+	} {
+		if err = indexer.Add(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summary, err := indexer.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Indexed != 1 || summary.Skipped != 1 {
+		t.Errorf("summary = %+v, want 1 indexed and 1 skipped", summary)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if want := map[string]string{"1": "Узел 1"}; !reflect.DeepEqual(renames, want) {
+		t.Errorf("renames = %v, want %v", renames, want)
+	}
+}
@@ -0,0 +1,158 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"math"
+	"search-service/proto/searchpb"
+	"strconv"
+)
+
+// NoDistance в Distances - у документа нет координат
+const NoDistance float64 = -1
+
+type SearchResult struct {
+	IDs       []int32
+	Total     int32
+	Distances []float64
+	Scores    []float64
+	MaxScore  float64
+	Sources   []json.RawMessage
+
+	Suggestions    []string
+	CorrectedQuery string
+
+	ParsedAddress *searchpb.ParsedAddress
+	StreetLevel   bool
+	AdminGroups   []AdminGroup
+}
+
+type searchHit struct {
+	ID     string          `json:"_id"`
+	Score  *float64        `json:"_score"`
+	Sort   []interface{}   `json:"sort"`
+	Source json.RawMessage `json:"_source"`
+}
+
+type searchResponse struct {
+	TimedOut bool `json:"timed_out"`
+	Hits     struct {
+		Total struct {
+			Value int32 `json:"value"`
+		} `json:"total"`
+		MaxScore *float64    `json:"max_score"`
+		Hits     []searchHit `json:"hits"`
+	} `json:"hits"`
+	Aggregations struct {
+		Admin struct {
+			Buckets []struct {
+				Key      []string `json:"key"`
+				DocCount int32    `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"admin"`
+	} `json:"aggregations"`
+}
+
+// withDistance: первым ключом сортировки был _geo_distance
+func decodeSearchResult(res *esapi.Response, withDistance bool) (*SearchResult, error) {
+	if res.IsError() {
+		return nil, fmt.Errorf("search failed: %s", res.String())
+	}
+
+	var r searchResponse
+
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	return r.result(withDistance)
+}
+
+func (r *searchResponse) result(withDistance bool) (*SearchResult, error) {
+	result := &SearchResult{Total: r.Hits.Total.Value}
+
+	if r.Hits.MaxScore != nil {
+		result.MaxScore = *r.Hits.MaxScore
+	}
+
+	for _, bucket := range r.Aggregations.Admin.Buckets {
+		if len(bucket.Key) != 3 {
+			continue
+		}
+
+		result.AdminGroups = append(result.AdminGroups, AdminGroup{
+			Region:   bucket.Key[0],
+			District: bucket.Key[1],
+			Locality: bucket.Key[2],
+			Count:    bucket.DocCount,
+		})
+	}
+
+	for _, hit := range r.Hits.Hits {
+		id, err := strconv.Atoi(hit.ID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %s: %v", hit.ID, err)
+		}
+
+		result.IDs = append(result.IDs, int32(id))
+
+		var score float64
+		if hit.Score != nil {
+			score = *hit.Score
+		}
+
+		result.Scores = append(result.Scores, score)
+		result.Sources = append(result.Sources, hit.Source)
+
+		if withDistance {
+			distance := NoDistance
+			// У документов без координат ES отдаёт в sort строку "Infinity"
+			if len(hit.Sort) > 0 {
+				if value, ok := hit.Sort[0].(float64); ok && !math.IsInf(value, 0) {
+					distance = value
+				}
+			}
+
+			result.Distances = append(result.Distances, distance)
+		}
+	}
+
+	return result, nil
+}
+
+func applySourceFilter(searchQuery map[string]interface{}, include bool, fields []string) {
+	if !include {
+		searchQuery["_source"] = false
+		return
+	}
+
+	source := map[string]interface{}{
+		"excludes": []string{"suggest"},
+	}
+
+	if len(fields) > 0 {
+		source["includes"] = fields
+	}
+
+	searchQuery["_source"] = source
+}
+
+// Порядок совпадает с IDs; для хитов без _source возвращается пустое сообщение
+func DecodeSources[T any](sources []json.RawMessage) ([]*T, error) {
+	docs := make([]*T, 0, len(sources))
+
+	for _, source := range sources {
+		doc := new(T)
+
+		if len(source) > 0 {
+			if err := json.Unmarshal(source, doc); err != nil {
+				return nil, err
+			}
+		}
+
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
@@ -0,0 +1,296 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"net/http"
+	"search-service/proto/searchpb"
+	"time"
+)
+
+const savedSearchesLimit = 1000
+
+var ErrSavedSearchNotFound = errors.New("saved search not found")
+
+type SavedSearchStore interface {
+	EnsureIndexSavedSearch(ctx context.Context) error
+	SaveSearch(ctx context.Context, saved *searchpb.SavedSearch) (*searchpb.SavedSearch, error)
+	ListSavedSearches(ctx context.Context, owner string, entity searchpb.Entity) ([]*searchpb.SavedSearch, error)
+	GetSavedSearch(ctx context.Context, id, owner string) (*searchpb.SavedSearch, error)
+	DeleteSavedSearch(ctx context.Context, id, owner string) error
+}
+
+type DefaultSavedSearchStore struct {
+	Elastic *elasticsearch.Client
+}
+
+// SaveSearch создаёт поиск или перезаписывает существующий, если у него тот же владелец.
+// Запрос проверяется сразу, чтобы синтаксическая ошибка не всплыла только при запуске
+func (s *DefaultSavedSearchStore) SaveSearch(ctx context.Context, saved *searchpb.SavedSearch) (*searchpb.SavedSearch, error) {
+	var err error
+
+	switch saved.GetEntity() {
+	case searchpb.Entity_ENTITY_NODE:
+		_, _, _, err = nodeQueryLanguage.compile(saved.GetNodes().GetSearch().GetQuery())
+	case searchpb.Entity_ENTITY_HARDWARE:
+		_, _, _, err = hardwareQueryLanguage.compile(saved.GetHardware().GetSearch().GetQuery())
+	default:
+		err = fmt.Errorf("unsupported entity %v", saved.GetEntity())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	saved.UpdatedAt = now
+	saved.CreatedAt = now
+
+	if saved.Id != "" {
+		existing, err := s.GetSavedSearch(ctx, saved.Id, saved.Owner)
+		if err != nil {
+			return nil, err
+		}
+
+		saved.CreatedAt = existing.CreatedAt
+	}
+
+	id := saved.Id
+	saved.Id = ""
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []func(*esapi.IndexRequest){
+		s.Elastic.Index.WithRefresh("true"),
+		s.Elastic.Index.WithContext(ctx),
+	}
+	if id != "" {
+		opts = append(opts, s.Elastic.Index.WithDocumentID(id))
+	}
+
+	res, err := s.Elastic.Index("saved_searches", bytes.NewReader(data), opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("save search failed: %s", res.String())
+	}
+
+	var r struct {
+		ID string `json:"_id"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	saved.Id = r.ID
+
+	return saved, nil
+}
+
+func (s *DefaultSavedSearchStore) ListSavedSearches(ctx context.Context, owner string, entity searchpb.Entity) ([]*searchpb.SavedSearch, error) {
+	filters := []map[string]interface{}{
+		{"term": map[string]interface{}{"owner": owner}},
+	}
+
+	if entity != searchpb.Entity_ENTITY_UNSPECIFIED {
+		filters = append(filters, map[string]interface{}{
+			"term": map[string]interface{}{"entity": entity},
+		})
+	}
+
+	searchQuery := map[string]interface{}{
+		"size": savedSearchesLimit,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": filters,
+			},
+		},
+		"sort": []map[string]interface{}{
+			{"updated_at": map[string]interface{}{"order": "desc"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(searchQuery); err != nil {
+		return nil, err
+	}
+
+	res, err := s.Elastic.Search(
+		s.Elastic.Search.WithContext(ctx),
+		s.Elastic.Search.WithIndex("saved_searches"),
+		s.Elastic.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	// Индекс создаётся при первом сохранении
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	var r searchResponse
+
+	if res.IsError() {
+		return nil, fmt.Errorf("list saved searches failed: %s", res.String())
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	searches := make([]*searchpb.SavedSearch, 0, len(r.Hits.Hits))
+	for _, hit := range r.Hits.Hits {
+		saved := &searchpb.SavedSearch{}
+		if err = json.Unmarshal(hit.Source, saved); err != nil {
+			return nil, err
+		}
+
+		saved.Id = hit.ID
+		searches = append(searches, saved)
+	}
+
+	return searches, nil
+}
+
+// Чужой поиск для владельца выглядит так же, как несуществующий
+func (s *DefaultSavedSearchStore) GetSavedSearch(ctx context.Context, id, owner string) (*searchpb.SavedSearch, error) {
+	res, err := s.Elastic.Get(
+		"saved_searches",
+		id,
+		s.Elastic.Get.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrSavedSearchNotFound
+	}
+
+	if res.IsError() {
+		return nil, fmt.Errorf("get saved search failed: %s", res.String())
+	}
+
+	var r struct {
+		ID     string          `json:"_id"`
+		Source json.RawMessage `json:"_source"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	saved := &searchpb.SavedSearch{}
+	if err = json.Unmarshal(r.Source, saved); err != nil {
+		return nil, err
+	}
+
+	if saved.Owner != owner {
+		return nil, ErrSavedSearchNotFound
+	}
+
+	saved.Id = r.ID
+
+	return saved, nil
+}
+
+func (s *DefaultSavedSearchStore) DeleteSavedSearch(ctx context.Context, id, owner string) error {
+	if _, err := s.GetSavedSearch(ctx, id, owner); err != nil {
+		return err
+	}
+
+	res, err := s.Elastic.Delete(
+		"saved_searches",
+		id,
+		s.Elastic.Delete.WithRefresh("true"),
+		s.Elastic.Delete.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return ErrSavedSearchNotFound
+	}
+
+	if res.IsError() {
+		return fmt.Errorf("delete saved search failed: %s", res.String())
+	}
+
+	return nil
+}
+
+func (s *DefaultSavedSearchStore) EnsureIndexSavedSearch(ctx context.Context) error {
+	res, err := s.Elastic.Indices.Exists([]string{"saved_searches"}, s.Elastic.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 200 {
+		return nil
+	}
+
+	// Сами запросы только хранятся, индексировать их поля незачем
+	storedRequest := map[string]interface{}{
+		"type":    "object",
+		"enabled": false,
+	}
+
+	settings := map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"owner": map[string]interface{}{
+					"type": "keyword",
+				},
+				"name": map[string]interface{}{
+					"type": "text",
+					"fields": map[string]interface{}{
+						"keyword": map[string]interface{}{
+							"type": "keyword",
+						},
+					},
+				},
+				"entity": map[string]interface{}{
+					"type": "integer",
+				},
+				"nodes":      storedRequest,
+				"hardware":   storedRequest,
+				"created_at": updatedAtMapping,
+				"updated_at": updatedAtMapping,
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err = json.NewEncoder(&buf).Encode(settings); err != nil {
+		return err
+	}
+
+	createRes, err := s.Elastic.Indices.Create(
+		"saved_searches",
+		s.Elastic.Indices.Create.WithBody(&buf),
+		s.Elastic.Indices.Create.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer createRes.Body.Close()
+
+	return nil
+}
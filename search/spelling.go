@@ -0,0 +1,187 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"log"
+	"search-service/proto/searchpb"
+	"sort"
+	"strings"
+)
+
+const maxCorrections = 5
+
+var (
+	nodeSpellFields     = []string{"name", "address.street_name"}
+	hardwareSpellFields = []string{"model_name", "node_name", "address.street_name"}
+	addressSpellFields  = []string{"street_name"}
+)
+
+func suggestCorrections(ctx context.Context, es *elasticsearch.Client, index string, fields []string, text string) ([]string, error) {
+	suggesters := map[string]interface{}{
+		"text": text,
+	}
+
+	for i, field := range fields {
+		suggesters[fmt.Sprintf("spell_%d", i)] = map[string]interface{}{
+			"phrase": map[string]interface{}{
+				"field":     field,
+				"size":      maxCorrections,
+				"gram_size": 1,
+				"direct_generator": []map[string]interface{}{
+					{
+						"field":           field,
+						"suggest_mode":    "always",
+						"min_word_length": 2,
+					},
+				},
+			},
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{
+		"size":    0,
+		"suggest": suggesters,
+	}); err != nil {
+		return nil, err
+	}
+
+	res, err := es.Search(
+		es.Search.WithContext(ctx),
+		es.Search.WithIndex(index),
+		es.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("spelling suggest failed: %s", res.String())
+	}
+
+	var r struct {
+		Suggest map[string][]struct {
+			Options []struct {
+				Text  string  `json:"text"`
+				Score float64 `json:"score"`
+			} `json:"options"`
+		} `json:"suggest"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	type option struct {
+		text  string
+		score float64
+	}
+
+	best := make(map[string]option)
+
+	for _, entries := range r.Suggest {
+		for _, entry := range entries {
+			for _, o := range entry.Options {
+				key := strings.ToLower(o.Text)
+				if key == strings.ToLower(text) {
+					continue
+				}
+
+				if prev, ok := best[key]; !ok || o.Score > prev.score {
+					best[key] = option{text: o.Text, score: o.Score}
+				}
+			}
+		}
+	}
+
+	options := make([]option, 0, len(best))
+	for _, o := range best {
+		options = append(options, o)
+	}
+
+	sort.Slice(options, func(i, j int) bool {
+		if options[i].score == options[j].score {
+			return options[i].text < options[j].text
+		}
+		return options[i].score > options[j].score
+	})
+
+	var corrections []string
+	for i := 0; i < len(options) && i < maxCorrections; i++ {
+		corrections = append(corrections, options[i].text)
+	}
+
+	return corrections, nil
+}
+
+// Вызывается только при Total == 0; ошибка подсказок не должна ронять сам поиск
+func correctZeroResults(ctx context.Context, es *elasticsearch.Client, index string, fields []string, text string, autoCorrect bool, result *SearchResult, rerun func(query string) (*SearchResult, error)) (*SearchResult, error) {
+	corrections, err := suggestCorrections(ctx, es, index, fields, text)
+	if err != nil {
+		log.Printf("failed to suggest corrections for %s: %v\n", index, err)
+		return result, nil
+	}
+
+	result.Suggestions = corrections
+
+	if !autoCorrect || len(corrections) == 0 {
+		return result, nil
+	}
+
+	corrected, err := rerun(corrections[0])
+	if err != nil {
+		return nil, err
+	}
+
+	corrected.Suggestions = corrections
+	corrected.CorrectedQuery = corrections[0]
+
+	return corrected, nil
+}
+
+func withQuery(search *searchpb.Search, query string) *searchpb.Search {
+	return &searchpb.Search{
+		Query:  query,
+		Offset: search.GetOffset(),
+		Limit:  search.GetLimit(),
+		Near:   search.GetNear(),
+
+		IncludeSource: search.GetIncludeSource(),
+		Fields:        search.GetFields(),
+	}
+}
+
+func withStreetQuery(search *searchpb.SearchAddress, query string) *searchpb.SearchAddress {
+	return &searchpb.SearchAddress{
+		StreetQuery: query,
+		HouseQuery:  search.GetHouseQuery(),
+		StreetType:  search.GetStreetType(),
+		Offset:      search.GetOffset(),
+		Limit:       search.GetLimit(),
+		Near:        search.GetNear(),
+		Geo:         search.GetGeo(),
+		Admin:       search.GetAdmin(),
+		PreferAdmin: search.GetPreferAdmin(),
+		AdminFacets: search.GetAdminFacets(),
+
+		IncludeSource: search.GetIncludeSource(),
+		Fields:        search.GetFields(),
+	}
+}
+
+// Обратная к ParseAddress сборка: "ул", "Ленина", "12" -> "ул Ленина 12"
+func joinAddressQuery(streetType, street, house string) string {
+	var parts []string
+	for _, part := range []string{streetType, street, house} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
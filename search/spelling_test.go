@@ -0,0 +1,28 @@
+package search
+
+import (
+	"testing"
+)
+
+func TestJoinAddressQuery(t *testing.T) {
+	tests := []struct {
+		text      string
+		corrected string
+		want      string
+	}{
+		{"ул Лениа 12", "Ленина", "ул Ленина 12"},
+		{"Лениа д 12к1", "Ленина", "Ленина 12к1"},
+		{"Лениа", "Ленина", "Ленина"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			parsed := ParseAddress(tt.text)
+
+			got := joinAddressQuery(parsed.GetStreetType(), tt.corrected, parsed.GetHouse())
+			if got != tt.want {
+				t.Errorf("joinAddressQuery(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
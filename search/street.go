@@ -0,0 +1,438 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"io"
+	"search-service/proto/searchpb"
+	"strconv"
+	"strings"
+)
+
+type StreetSearch interface {
+	EnsureIndexStreet(ctx context.Context) error
+	IndexStreets(ctx context.Context, streets []*searchpb.Street) error
+	IndexStreet(ctx context.Context, street *searchpb.Street) error
+}
+
+type DefaultStreetSearch struct {
+	Elastic *elasticsearch.Client
+	Cache   *SearchCache
+}
+
+var streetSpellFields = []string{"name"}
+
+func (s *DefaultStreetSearch) IndexStreet(ctx context.Context, street *searchpb.Street) error {
+	defer s.Cache.Invalidate("streets")
+
+	data, err := json.Marshal(street)
+	if err != nil {
+		return err
+	}
+
+	req := bytes.NewReader(data)
+
+	opts := append([]func(*esapi.IndexRequest){
+		s.Elastic.Index.WithDocumentID(fmt.Sprint(street.Id)),
+		s.Elastic.Index.WithRefresh("true"),
+		s.Elastic.Index.WithContext(ctx),
+	}, indexVersionOptions(s.Elastic, street.GetUpdatedAt())...)
+
+	res, err := s.Elastic.Index("streets", req, opts...)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return checkIndexResponse(res, "streets")
+}
+
+func (s *DefaultStreetSearch) IndexStreets(ctx context.Context, streets []*searchpb.Street) error {
+	defer s.Cache.Invalidate("streets")
+
+	var buf bytes.Buffer
+
+	for _, street := range streets {
+		meta := bulkIndexMeta(street.Id, street.GetUpdatedAt())
+
+		data, err := json.Marshal(street)
+		if err != nil {
+			return err
+		}
+
+		data = append(data, '\n')
+
+		buf.Grow(len(meta) + len(data))
+
+		buf.Write(meta)
+		buf.Write(data)
+	}
+
+	res, err := s.Elastic.Bulk(
+		bytes.NewReader(buf.Bytes()),
+		s.Elastic.Bulk.WithIndex("streets"),
+		s.Elastic.Bulk.WithRefresh("true"),
+		s.Elastic.Bulk.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("bulk failed: %s", res.String())
+	}
+
+	return checkBulkResponse(res)
+}
+
+func (s *DefaultStreetSearch) EnsureIndexStreet(ctx context.Context) error {
+	res, err := s.Elastic.Indices.Exists([]string{"streets"}, s.Elastic.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	exists := res.StatusCode == 200
+
+	settings := map[string]interface{}{
+		"settings": map[string]interface{}{
+			"analysis": map[string]interface{}{
+				"filter": map[string]interface{}{
+					"edge_ngram_filter": map[string]interface{}{
+						"type":     "edge_ngram",
+						"min_gram": 1,
+						"max_gram": 20,
+					},
+				},
+				"analyzer": map[string]interface{}{
+					"edge_ngram_analyzer": map[string]interface{}{
+						"type":      "custom",
+						"tokenizer": "standard",
+						"filter":    []string{"lowercase", "edge_ngram_filter"},
+					},
+				},
+			},
+		},
+		"mappings": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"name": map[string]interface{}{
+					"type": "text",
+					"fields": map[string]interface{}{
+						"edge": map[string]interface{}{
+							"type":            "text",
+							"analyzer":        "edge_ngram_analyzer",
+							"search_analyzer": "standard",
+						},
+						"keyword": map[string]interface{}{
+							"type": "keyword",
+						},
+					},
+				},
+				"type_short_name": map[string]interface{}{
+					"type": "keyword",
+				},
+				"house_count": map[string]interface{}{
+					"type": "integer",
+				},
+				"region":     adminKeywordMapping,
+				"district":   adminKeywordMapping,
+				"locality":   adminKeywordMapping,
+				"updated_at": updatedAtMapping,
+			},
+		},
+	}
+
+	if exists {
+		return putMissingMappings(ctx, s.Elastic, "streets", settings)
+	}
+
+	var buf bytes.Buffer
+	if err = json.NewEncoder(&buf).Encode(settings); err != nil {
+		return err
+	}
+
+	createRes, err := s.Elastic.Indices.Create(
+		"streets",
+		s.Elastic.Indices.Create.WithBody(&buf),
+		s.Elastic.Indices.Create.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer createRes.Body.Close()
+
+	return nil
+}
+
+func buildStreetSearchQuery(search *searchpb.SearchAddress) map[string]interface{} {
+	query := map[string]interface{}{
+		"must": map[string]interface{}{
+			"match": map[string]interface{}{
+				"name.edge": map[string]interface{}{
+					"query": search.GetStreetQuery(),
+					"boost": 3,
+				},
+			},
+		},
+	}
+
+	should := buildAdminBoost("", search.GetPreferAdmin())
+
+	if streetType := search.GetStreetType(); streetType != "" {
+		should = append(should, map[string]interface{}{
+			"term": map[string]interface{}{
+				"type_short_name": map[string]interface{}{
+					"value": streetType,
+					"boost": 2,
+				},
+			},
+		})
+	}
+
+	if len(should) > 0 {
+		query["should"] = should
+	}
+
+	if filters := buildAdminFilter("", search.GetAdmin()); len(filters) > 0 {
+		query["filter"] = filters
+	}
+
+	searchQuery := map[string]interface{}{
+		"from": search.GetOffset(),
+		"size": search.GetLimit(),
+		"query": map[string]interface{}{
+			"bool": query,
+		},
+		"sort": []map[string]interface{}{
+			{
+				"_score": map[string]interface{}{
+					"order": "desc",
+				},
+			},
+			{
+				"house_count": map[string]interface{}{
+					"order":   "desc",
+					"missing": "_last",
+				},
+			},
+			{
+				"name.keyword": map[string]interface{}{
+					"order": "asc",
+				},
+			},
+		},
+		"track_total_hits": true,
+	}
+
+	if search.GetAdminFacets() {
+		searchQuery["aggs"] = map[string]interface{}{
+			"admin": buildAdminAggregation(""),
+		}
+	}
+
+	applySourceFilter(searchQuery, search.GetIncludeSource(), search.GetFields())
+
+	return searchQuery
+}
+
+// buildStreetAggregationQuery - тот же поиск улиц, но по индексу домов: дома группируются по street_id,
+// улица получает лучший балл своих домов
+// Дома, проиндексированные до появления street_id, группируются по типу и названию улицы
+const streetKeyScript = `
+if (doc.containsKey('street_id') && doc['street_id'].size() > 0) {
+	return 'id:' + doc['street_id'].value;
+}
+String type = doc.containsKey('street_type_short_name') && doc['street_type_short_name'].size() > 0 ? doc['street_type_short_name'].value : '';
+String name = doc.containsKey('street_name.keyword') && doc['street_name.keyword'].size() > 0 ? doc['street_name.keyword'].value : '';
+return 'name:' + type + '|' + name;
+`
+
+func buildStreetAggregationQuery(search *searchpb.SearchAddress) map[string]interface{} {
+	query := map[string]interface{}{
+		"must": map[string]interface{}{
+			"match": map[string]interface{}{
+				"street_name.edge": map[string]interface{}{
+					"query": search.GetStreetQuery(),
+					"boost": 3,
+				},
+			},
+		},
+	}
+
+	should := buildAdminBoost("", search.GetPreferAdmin())
+
+	if streetType := search.GetStreetType(); streetType != "" {
+		should = append(should, map[string]interface{}{
+			"term": map[string]interface{}{
+				"street_type_short_name": map[string]interface{}{
+					"value": streetType,
+					"boost": 2,
+				},
+			},
+		})
+	}
+
+	if len(should) > 0 {
+		query["should"] = should
+	}
+
+	if filters := buildAdminFilter("", search.GetAdmin()); len(filters) > 0 {
+		query["filter"] = filters
+	}
+
+	streetKey := map[string]interface{}{
+		"source": streetKeyScript,
+		"lang":   "painless",
+	}
+
+	// terms не принимает size 0; при limit 0 лишний бакет отбросит decodeStreetAggregation
+	size := max(search.GetOffset()+search.GetLimit(), 1)
+
+	aggs := map[string]interface{}{
+		"streets": map[string]interface{}{
+			"terms": map[string]interface{}{
+				"script": streetKey,
+				"size":   size,
+				"order": []map[string]interface{}{
+					{"max_score": "desc"},
+					{"_count": "desc"},
+				},
+			},
+			"aggs": map[string]interface{}{
+				"max_score": map[string]interface{}{
+					"max": map[string]interface{}{"script": "_score"},
+				},
+				"street": map[string]interface{}{
+					"top_hits": map[string]interface{}{
+						"size":    1,
+						"_source": []string{"street_name", "street_type_short_name", "region", "district", "locality"},
+					},
+				},
+			},
+		},
+		"street_count": map[string]interface{}{
+			"cardinality": map[string]interface{}{"script": streetKey},
+		},
+	}
+
+	if search.GetAdminFacets() {
+		aggs["admin"] = buildAdminAggregation("")
+	}
+
+	return map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": query,
+		},
+		"aggs": aggs,
+	}
+}
+
+func decodeStreetAggregation(res *esapi.Response, offset, limit int32) (*SearchResult, error) {
+	if res.IsError() {
+		return nil, fmt.Errorf("search failed: %s", res.String())
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Группы по административному делению разбирает общий searchResponse, хитов в ответе нет
+	var r searchResponse
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+
+	var streets struct {
+		Aggregations struct {
+			Streets struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int32  `json:"doc_count"`
+					MaxScore struct {
+						Value float64 `json:"value"`
+					} `json:"max_score"`
+					Street struct {
+						Hits struct {
+							Hits []struct {
+								Source struct {
+									StreetName          string `json:"street_name"`
+									StreetTypeShortName string `json:"street_type_short_name"`
+									Region              string `json:"region"`
+									District            string `json:"district"`
+									Locality            string `json:"locality"`
+								} `json:"_source"`
+							} `json:"hits"`
+						} `json:"hits"`
+					} `json:"street"`
+				} `json:"buckets"`
+			} `json:"streets"`
+			StreetCount struct {
+				Value int32 `json:"value"`
+			} `json:"street_count"`
+		} `json:"aggregations"`
+	}
+
+	if err = json.Unmarshal(data, &streets); err != nil {
+		return nil, err
+	}
+
+	result, err := r.result(false)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Total = streets.Aggregations.StreetCount.Value
+
+	buckets := streets.Aggregations.Streets.Buckets
+	if int(offset) >= len(buckets) {
+		return result, nil
+	}
+
+	buckets = buckets[offset:]
+	if int(limit) < len(buckets) {
+		buckets = buckets[:limit]
+	}
+
+	for _, bucket := range buckets {
+		// У улиц, собранных по названию, идентификатора нет - Id остаётся 0
+		var id int32
+		if key, ok := strings.CutPrefix(bucket.Key, "id:"); ok {
+			n, err := strconv.Atoi(key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid street key %s: %v", bucket.Key, err)
+			}
+
+			id = int32(n)
+		}
+
+		street := &searchpb.Street{Id: id, HouseCount: bucket.DocCount}
+
+		if hits := bucket.Street.Hits.Hits; len(hits) > 0 {
+			address := hits[0].Source
+			street.Name = address.StreetName
+			street.TypeShortName = address.StreetTypeShortName
+			street.Region = address.Region
+			street.District = address.District
+			street.Locality = address.Locality
+		}
+
+		source, err := json.Marshal(street)
+		if err != nil {
+			return nil, err
+		}
+
+		result.IDs = append(result.IDs, id)
+		result.Scores = append(result.Scores, bucket.MaxScore.Value)
+		result.Sources = append(result.Sources, source)
+		result.MaxScore = max(result.MaxScore, bucket.MaxScore.Value)
+	}
+
+	return result, nil
+}
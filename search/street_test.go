@@ -0,0 +1,97 @@
+package search
+
+import (
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"io"
+	"reflect"
+	"search-service/proto/searchpb"
+	"strings"
+	"testing"
+)
+
+func TestBuildStreetAggregationQuerySize(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int32
+		limit  int32
+		want   int32
+	}{
+		{"offset and limit", 10, 5, 15},
+		{"zero limit", 0, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := buildStreetAggregationQuery(&searchpb.SearchAddress{StreetQuery: "лен", Offset: tt.offset, Limit: tt.limit})
+
+			terms := query["aggs"].(map[string]interface{})["streets"].(map[string]interface{})["terms"].(map[string]interface{})
+			if terms["size"] != tt.want {
+				t.Errorf("size = %v, want %d", terms["size"], tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeStreetAggregation(t *testing.T) {
+	body := `{
+		"hits": {"total": {"value": 3}, "max_score": null, "hits": []},
+		"aggregations": {
+			"street_count": {"value": 3},
+			"streets": {"buckets": [
+				{"key": "id:7", "doc_count": 4, "max_score": {"value": 2.5},
+					"street": {"hits": {"hits": [{"_source": {"street_name": "Ленина", "street_type_short_name": "ул"}}]}}},
+				{"key": "name:пр-кт|Мира", "doc_count": 2, "max_score": {"value": 1.5},
+					"street": {"hits": {"hits": [{"_source": {"street_name": "Мира", "street_type_short_name": "пр-кт"}}]}}},
+				{"key": "id:9", "doc_count": 1, "max_score": {"value": 1},
+					"street": {"hits": {"hits": []}}}
+			]}
+		}
+	}`
+
+	tests := []struct {
+		name   string
+		offset int32
+		limit  int32
+		ids    []int32
+	}{
+		// Улица без street_id группируется по названию и приходит с Id 0
+		{"all", 0, 10, []int32{7, 0, 9}},
+		{"offset", 1, 1, []int32{0}},
+		{"zero limit", 0, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &esapi.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(body))}
+
+			result, err := decodeStreetAggregation(res, tt.offset, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(result.IDs, tt.ids) {
+				t.Errorf("ids = %v, want %v", result.IDs, tt.ids)
+			}
+
+			if result.Total != 3 {
+				t.Errorf("total = %d, want 3", result.Total)
+			}
+		})
+	}
+}
+
+func TestStreetQueriesAdminFacetsOptIn(t *testing.T) {
+	for _, facets := range []bool{false, true} {
+		search := &searchpb.SearchAddress{StreetQuery: "лен", Limit: 10, AdminFacets: facets}
+
+		aggs, _ := buildStreetSearchQuery(search)["aggs"].(map[string]interface{})
+		if _, ok := aggs["admin"]; ok != facets {
+			t.Errorf("streets index: admin aggregation = %v, want %v", ok, facets)
+		}
+
+		aggs = buildStreetAggregationQuery(search)["aggs"].(map[string]interface{})
+		if _, ok := aggs["admin"]; ok != facets {
+			t.Errorf("addresses index: admin aggregation = %v, want %v", ok, facets)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"search-service/proto/searchpb"
+	"strings"
+)
+
+const (
+	defaultSuggestLimit = 10
+	// anyContext пишется в каждую категорию контекста любого документа. ES не принимает
+	// запрос к полю с контекстами без contexts, и по этому значению ищем без фильтра
+	anyContext = "_any"
+	// Во сколько раз больше подсказок запрашиваем, когда часть из них отсеется по категориям
+	suggestOverfetch = 5
+)
+
+type Suggester interface {
+	Suggest(ctx context.Context, req *searchpb.SuggestRequest) ([]string, error)
+}
+
+type DefaultSuggester struct {
+	Elastic *elasticsearch.Client
+	Cache   *SearchCache
+}
+
+type suggestQuery struct {
+	index string
+	field string
+	body  map[string]interface{}
+	limit int
+	// Категории, каждой из которых должна соответствовать подсказка. ES объединяет их через ИЛИ
+	required map[string][]string
+}
+
+type completionInput struct {
+	Input    []string            `json:"input"`
+	Weight   int32               `json:"weight"`
+	Contexts map[string][]string `json:"contexts,omitempty"`
+}
+
+var completionAnalyzer = map[string]interface{}{
+	"type":      "custom",
+	"tokenizer": "keyword",
+	"filter":    []string{"lowercase"},
+}
+
+func completionMapping(contexts ...string) map[string]interface{} {
+	mapping := map[string]interface{}{
+		"type":     "completion",
+		"analyzer": "completion_analyzer",
+	}
+
+	if len(contexts) > 0 {
+		var defs []map[string]interface{}
+		for _, name := range contexts {
+			defs = append(defs, map[string]interface{}{
+				"name": name,
+				"type": "category",
+			})
+		}
+
+		mapping["contexts"] = defs
+	}
+
+	return mapping
+}
+
+// "Узел Ленина 12" -> ["Узел Ленина 12", "Ленина 12", "12"], чтобы префикс находил и слова в середине
+func newCompletionInput(text string, popularity int32, contexts map[string][]string) *completionInput {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return nil
+	}
+
+	var inputs []string
+	for i := range words {
+		inputs = append(inputs, strings.Join(words[i:], " "))
+	}
+
+	if popularity < 1 {
+		popularity = 1
+	}
+
+	// Пустые значения (узел без зоны) не пишем, такой документ находится только через anyContext
+	for name, values := range contexts {
+		nonEmpty := []string{anyContext}
+		for _, v := range values {
+			if v != "" {
+				nonEmpty = append(nonEmpty, v)
+			}
+		}
+
+		contexts[name] = nonEmpty
+	}
+
+	return &completionInput{
+		Input:    inputs,
+		Weight:   popularity,
+		Contexts: contexts,
+	}
+}
+
+func (s *DefaultSuggester) Suggest(ctx context.Context, req *searchpb.SuggestRequest) ([]string, error) {
+	indices := map[searchpb.Entity][]string{
+		searchpb.Entity_ENTITY_NODE:     {"nodes"},
+		searchpb.Entity_ENTITY_HARDWARE: {"hardware"},
+		searchpb.Entity_ENTITY_ADDRESS:  {"addresses"},
+	}
+
+	return cachedSearch(s.Cache, "suggest", indices[req.GetEntity()], req, req.GetBypassCache(), func() ([]string, error) {
+		return s.suggest(ctx, req)
+	})
+}
+
+func (s *DefaultSuggester) suggest(ctx context.Context, req *searchpb.SuggestRequest) ([]string, error) {
+	q, err := buildSuggestQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = json.NewEncoder(&buf).Encode(q.body); err != nil {
+		return nil, err
+	}
+
+	res, err := s.Elastic.Search(
+		s.Elastic.Search.WithContext(ctx),
+		s.Elastic.Search.WithIndex(q.index),
+		s.Elastic.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("suggest failed: %s", res.String())
+	}
+
+	var r struct {
+		Suggest struct {
+			Suggestions []struct {
+				Options []struct {
+					Text   string                     `json:"text"`
+					Source map[string]json.RawMessage `json:"_source"`
+				} `json:"options"`
+			} `json:"suggestions"`
+		} `json:"suggest"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	// text - совпавший input, который может быть хвостом названия, поэтому отдаём полное значение из _source
+	seen := make(map[string]struct{})
+	suggestions := []string{}
+
+	for _, entry := range r.Suggest.Suggestions {
+		for _, option := range entry.Options {
+			if len(suggestions) == q.limit {
+				break
+			}
+
+			if !matchesContexts(option.Source["suggest"], q.required) {
+				continue
+			}
+
+			var text string
+			_ = json.Unmarshal(option.Source[q.field], &text)
+			if text == "" {
+				text = option.Text
+			}
+
+			key := strings.ToLower(text)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+
+			seen[key] = struct{}{}
+			suggestions = append(suggestions, text)
+		}
+	}
+
+	return suggestions, nil
+}
+
+// Подсказка подходит, если в каждой запрошенной категории совпало хотя бы одно значение
+func matchesContexts(source json.RawMessage, required map[string][]string) bool {
+	if len(required) == 0 {
+		return true
+	}
+
+	var suggest completionInput
+	if err := json.Unmarshal(source, &suggest); err != nil {
+		return false
+	}
+
+	for name, values := range required {
+		if !containsAny(suggest.Contexts[name], values) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsAny(values, wanted []string) bool {
+	for _, v := range values {
+		for _, w := range wanted {
+			if v == w {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func buildSuggestQuery(req *searchpb.SuggestRequest) (*suggestQuery, error) {
+	q := &suggestQuery{}
+
+	var categories []string
+	requested := map[string][]string{}
+
+	switch req.GetEntity() {
+	case searchpb.Entity_ENTITY_NODE:
+		q.index, q.field = "nodes", "name"
+		categories = []string{"zone", "type"}
+		requested["zone"] = req.GetZones()
+		requested["type"] = req.GetTypes()
+	case searchpb.Entity_ENTITY_HARDWARE:
+		q.index, q.field = "hardware", "model_name"
+		categories = []string{"type"}
+		requested["type"] = req.GetTypes()
+	case searchpb.Entity_ENTITY_ADDRESS:
+		q.index, q.field = "addresses", "street_name"
+	default:
+		return nil, fmt.Errorf("unsupported entity %v", req.GetEntity())
+	}
+
+	// Контексты разных категорий ES объединяет через ИЛИ, поэтому anyContext отправляем,
+	// только если не задан ни один фильтр - иначе он снял бы остальные
+	contexts := map[string]interface{}{}
+	required := map[string][]string{}
+	for _, name := range categories {
+		if values := requested[name]; len(values) > 0 {
+			contexts[name] = values
+			required[name] = values
+		}
+	}
+
+	if len(contexts) == 0 {
+		for _, name := range categories {
+			contexts[name] = []string{anyContext}
+		}
+	}
+
+	limit := req.GetLimit()
+	if limit <= 0 {
+		limit = defaultSuggestLimit
+	}
+
+	q.limit = int(limit)
+	size := limit
+	source := []string{q.field}
+
+	// Фильтр по нескольким категориям должен быть пересечением: ES вернёт объединение,
+	// поэтому берём подсказки с запасом вместе с контекстами и отсеиваем лишние сами
+	if len(required) > 1 {
+		q.required = required
+		size = limit * suggestOverfetch
+		source = append(source, "suggest.contexts")
+	}
+
+	completion := map[string]interface{}{
+		"field":           "suggest",
+		"size":            size,
+		"skip_duplicates": true,
+	}
+
+	if len(contexts) > 0 {
+		completion["contexts"] = contexts
+	}
+
+	q.body = map[string]interface{}{
+		"_source": source,
+		"suggest": map[string]interface{}{
+			"suggestions": map[string]interface{}{
+				"prefix":     req.GetPrefix(),
+				"completion": completion,
+			},
+		},
+	}
+
+	return q, nil
+}
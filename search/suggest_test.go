@@ -0,0 +1,126 @@
+package search
+
+import (
+	"encoding/json"
+	"reflect"
+	"search-service/proto/searchpb"
+	"testing"
+)
+
+func suggestContexts(t *testing.T, req *searchpb.SuggestRequest) interface{} {
+	t.Helper()
+
+	q, err := buildSuggestQuery(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	completion := q.body["suggest"].(map[string]interface{})["suggestions"].(map[string]interface{})["completion"].(map[string]interface{})
+
+	return completion["contexts"]
+}
+
+func TestBuildSuggestQueryContexts(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *searchpb.SuggestRequest
+		want interface{}
+	}{
+		{
+			name: "node without filter",
+			req:  &searchpb.SuggestRequest{Entity: searchpb.Entity_ENTITY_NODE, Prefix: "уз"},
+			want: map[string]interface{}{"zone": []string{anyContext}, "type": []string{anyContext}},
+		},
+		{
+			name: "node by zone",
+			req:  &searchpb.SuggestRequest{Entity: searchpb.Entity_ENTITY_NODE, Prefix: "уз", Zones: []string{"north"}},
+			want: map[string]interface{}{"zone": []string{"north"}},
+		},
+		{
+			name: "node by zone and type",
+			req:  &searchpb.SuggestRequest{Entity: searchpb.Entity_ENTITY_NODE, Prefix: "уз", Zones: []string{"north"}, Types: []string{"olt"}},
+			want: map[string]interface{}{"zone": []string{"north"}, "type": []string{"olt"}},
+		},
+		{
+			name: "hardware without filter",
+			req:  &searchpb.SuggestRequest{Entity: searchpb.Entity_ENTITY_HARDWARE, Prefix: "dl"},
+			want: map[string]interface{}{"type": []string{anyContext}},
+		},
+		{
+			name: "address has no contexts",
+			req:  &searchpb.SuggestRequest{Entity: searchpb.Entity_ENTITY_ADDRESS, Prefix: "лен"},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := suggestContexts(t, tt.req); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("contexts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// ES объединяет категории через ИЛИ, поэтому зона и тип вместе проверяются уже по ответу
+func TestSuggestZoneAndTypeIntersect(t *testing.T) {
+	q, err := buildSuggestQuery(&searchpb.SuggestRequest{
+		Entity: searchpb.Entity_ENTITY_NODE,
+		Prefix: "уз",
+		Limit:  2,
+		Zones:  []string{"north"},
+		Types:  []string{"olt", "switch"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{"zone": {"north"}, "type": {"olt", "switch"}}
+	if !reflect.DeepEqual(q.required, want) {
+		t.Fatalf("required = %v, want %v", q.required, want)
+	}
+
+	completion := q.body["suggest"].(map[string]interface{})["suggestions"].(map[string]interface{})["completion"].(map[string]interface{})
+	if size := completion["size"]; size != int32(2*suggestOverfetch) {
+		t.Errorf("size = %v, want %d", size, 2*suggestOverfetch)
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		want   bool
+	}{
+		{"both match", `{"contexts":{"zone":["_any","north"],"type":["_any","olt"]}}`, true},
+		{"zone only", `{"contexts":{"zone":["_any","north"],"type":["_any","onu"]}}`, false},
+		{"type only", `{"contexts":{"zone":["_any","south"],"type":["_any","switch"]}}`, false},
+		{"no zone", `{"contexts":{"zone":["_any"],"type":["_any","olt"]}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesContexts(json.RawMessage(tt.source), q.required); got != tt.want {
+				t.Errorf("matchesContexts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCompletionInputContexts(t *testing.T) {
+	input := newCompletionInput("Узел 1", 0, map[string][]string{
+		"zone": {""},
+		"type": {"olt"},
+	})
+
+	want := map[string][]string{
+		"zone": {anyContext},
+		"type": {anyContext, "olt"},
+	}
+
+	if !reflect.DeepEqual(input.Contexts, want) {
+		t.Errorf("contexts = %v, want %v", input.Contexts, want)
+	}
+
+	if input.Weight != 1 {
+		t.Errorf("weight = %d, want 1", input.Weight)
+	}
+}
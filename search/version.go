@@ -0,0 +1,117 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"net/http"
+	"search-service/metrics"
+)
+
+// Версия документа - updated_at из источника. external_gte не даёт устаревшему сообщению
+// перезаписать более новую версию, но пропускает повторную отправку той же самой.
+// Патчи пишут документ целиком с версией своего updated_at. _update_by_query (переименования,
+// каскады) увеличивает _version на единицу, и он обгоняет updated_at: повторная отправка
+// с тем же updated_at после такого обновления считается конфликтом и пропускается.
+// Данные в индексе при этом не старее присланных
+const versionType = "external_gte"
+
+func versionConflict(index string) {
+	metrics.VersionConflicts.WithLabelValues(index).Inc()
+}
+
+// observeBulkItem учитывает результат записи одного документа пачкой
+func observeBulkItem(index string, status int) {
+	switch {
+	case status == http.StatusConflict:
+		versionConflict(index)
+		metrics.BulkDocuments.WithLabelValues(index, "version_conflict").Inc()
+	case status >= 300:
+		metrics.BulkDocuments.WithLabelValues(index, "failed").Inc()
+	default:
+		metrics.BulkDocuments.WithLabelValues(index, "indexed").Inc()
+	}
+}
+
+// Без версии (источник не прислал updated_at) остаётся внутреннее версионирование ES
+func bulkIndexMeta(id int32, version int64) []byte {
+	if version <= 0 {
+		return []byte(fmt.Sprintf(`{ "index" : { "_id" : "%d" } }%s`, id, "\n"))
+	}
+
+	return []byte(fmt.Sprintf(`{ "index" : { "_id" : "%d", "version" : %d, "version_type" : "%s" } }%s`, id, version, versionType, "\n"))
+}
+
+func indexVersionOptions(es *elasticsearch.Client, version int64) []func(*esapi.IndexRequest) {
+	if version <= 0 {
+		return nil
+	}
+
+	return []func(*esapi.IndexRequest){
+		es.Index.WithVersion(int(version)),
+		es.Index.WithVersionType(versionType),
+	}
+}
+
+// Конфликт версий - это не ошибка: в индексе уже более новые данные
+func checkIndexResponse(res *esapi.Response, index string) error {
+	if res.StatusCode == http.StatusConflict {
+		versionConflict(index)
+		return nil
+	}
+
+	if res.IsError() {
+		return fmt.Errorf("index failed: %s", res.String())
+	}
+
+	return nil
+}
+
+func checkBulkResponse(res *esapi.Response) error {
+	_, err := decodeBulkResponse(res)
+	return err
+}
+
+// decodeBulkResponse возвращает _id действительно записанных документов: конфликт версий
+// не ошибка, но такой документ в индексе не изменился
+func decodeBulkResponse(res *esapi.Response) (map[string]bool, error) {
+	if res.IsError() {
+		return nil, fmt.Errorf("bulk request failed: %s", res.String())
+	}
+
+	var bulkResp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID     string `json:"_id"`
+			Index  string `json:"_index"`
+			Status int    `json:"status"`
+		} `json:"items"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&bulkResp); err != nil {
+		return nil, err
+	}
+
+	written := make(map[string]bool, len(bulkResp.Items))
+	failed := 0
+
+	for _, item := range bulkResp.Items {
+		for _, result := range item {
+			observeBulkItem(result.Index, result.Status)
+
+			switch {
+			case result.Status < 300:
+				written[result.ID] = true
+			case result.Status != http.StatusConflict:
+				failed++
+			}
+		}
+	}
+
+	if failed > 0 {
+		return written, fmt.Errorf("bulk indexing had errors")
+	}
+
+	return written, nil
+}
@@ -0,0 +1,48 @@
+package search
+
+import (
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeBulkResponse(t *testing.T) {
+	body := `{"errors": true, "items": [
+		{"index": {"_index": "addresses", "_id": "1", "status": 201}},
+		{"index": {"_index": "addresses", "_id": "2", "status": 200}},
+		{"index": {"_index": "addresses", "_id": "3", "status": 409}}
+	]}`
+
+	res := &esapi.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(body))}
+
+	written, err := decodeBulkResponse(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Устаревший документ не ошибка, но и не записан: каскад его не получит
+	want := map[string]bool{"1": true, "2": true}
+	if !reflect.DeepEqual(written, want) {
+		t.Errorf("written = %v, want %v", written, want)
+	}
+}
+
+func TestDecodeBulkResponseItemError(t *testing.T) {
+	body := `{"errors": true, "items": [
+		{"index": {"_index": "addresses", "_id": "1", "status": 201}},
+		{"index": {"_index": "addresses", "_id": "2", "status": 400}}
+	]}`
+
+	res := &esapi.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(body))}
+
+	written, err := decodeBulkResponse(res)
+	if err == nil {
+		t.Fatal("expected error for failed item")
+	}
+
+	if !reflect.DeepEqual(written, map[string]bool{"1": true}) {
+		t.Errorf("written = %v, want only 1", written)
+	}
+}